@@ -0,0 +1,137 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dockerparser
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultCacheSize is the number of entries kept by a Cache created with a non-positive size.
+const DefaultCacheSize = 4096
+
+// Cache is a bounded cache in front of Parse, evicting the least recently used entries first.
+// Results are interned: every call for a given remote identifier returns the same Reference, or the
+// same error if it's invalid.
+//
+// References returned by a Cache are shared and must be considered immutable: they must never be
+// given to ParseInto.
+//
+// A Cache is safe for concurrent use by multiple goroutines.
+type Cache struct {
+	mutex   sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	hits    uint64
+	misses  uint64
+}
+
+// CacheStats reports the usage of a Cache.
+type CacheStats struct {
+	// Hits is the number of lookups served from the cache.
+	Hits uint64
+	// Misses is the number of lookups that required a Parse.
+	Misses uint64
+	// Len is the number of entries currently in the cache.
+	Len int
+}
+
+type cacheEntry struct {
+	remote    string
+	reference *Reference
+	err       error
+}
+
+// NewCache returns a Cache holding at most size entries.
+// If size isn't positive, DefaultCacheSize is used instead.
+func NewCache(size int) *Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &Cache{
+		size:    size,
+		entries: make(map[string]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// Parse returns a Reference from analyzing the given remote identifier, using a previous result if
+// it's still in the cache.
+func (c *Cache) Parse(remote string) (*Reference, error) {
+
+	c.mutex.Lock()
+	if element, ok := c.entries[remote]; ok {
+		c.hits++
+		c.order.MoveToFront(element)
+		entry := element.Value.(*cacheEntry)
+		c.mutex.Unlock()
+		return entry.reference, entry.err
+	}
+	c.misses++
+	c.mutex.Unlock()
+
+	// Since a Reference is a view on its remote identifier, copy it so that the cache doesn't retain
+	// a larger string the identifier would have been sliced from.
+	remote = string([]byte(remote))
+	reference, err := Parse(remote)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Another goroutine may have parsed the same remote identifier in the meantime.
+	if element, ok := c.entries[remote]; ok {
+		c.order.MoveToFront(element)
+		entry := element.Value.(*cacheEntry)
+		return entry.reference, entry.err
+	}
+
+	c.entries[remote] = c.order.PushFront(&cacheEntry{
+		remote:    remote,
+		reference: reference,
+		err:       err,
+	})
+
+	for c.order.Len() > c.size {
+		element := c.order.Back()
+		c.order.Remove(element)
+		delete(c.entries, element.Value.(*cacheEntry).remote)
+	}
+
+	return reference, err
+}
+
+// Stats returns the hit and miss counters of the cache, along with its current length.
+func (c *Cache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return CacheStats{
+		Hits:   c.hits,
+		Misses: c.misses,
+		Len:    c.order.Len(),
+	}
+}
+
+// Purge removes every entry from the cache. Counters are left untouched.
+func (c *Cache) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = make(map[string]*list.Element, c.size)
+	c.order.Init()
+}
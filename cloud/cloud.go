@@ -0,0 +1,206 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package cloud classifies references by the provider of their registry, such as Amazon ECR or
+// Google Artifact Registry, and extracts the metadata encoded in their names, such as the AWS
+// account and region of 123456789012.dkr.ecr.eu-west-1.amazonaws.com. It works offline, from a
+// table of rules which can be extended.
+package cloud
+
+import (
+	"regexp"
+	"strings"
+
+	dockerparser "github.com/novln/docker-parser"
+)
+
+// Provider identifies a registry provider.
+type Provider string
+
+// Providers recognized by DefaultRules.
+const (
+	ECR              Provider = "ecr"
+	ECRPublic        Provider = "ecr-public"
+	GCR              Provider = "gcr"
+	ArtifactRegistry Provider = "artifact-registry"
+	ACR              Provider = "acr"
+	GHCR             Provider = "ghcr"
+	Quay             Provider = "quay"
+	DockerHub        Provider = "docker-hub"
+)
+
+// Info is the provider of the registry of a reference, and the metadata encoded in its name.
+type Info struct {
+	// Provider is the provider of the registry.
+	Provider Provider
+	// Registry is the registry of the reference.
+	Registry string
+	// AccountID is the AWS account owning an ECR registry.
+	AccountID string
+	// Region is the AWS region of an ECR registry.
+	Region string
+	// Partition is the AWS partition of an ECR registry. (ie: aws, aws-cn or aws-us-gov)
+	Partition string
+	// FIPS is true if an ECR registry is accessed with its FIPS endpoint.
+	FIPS bool
+	// Project is the GCP project of a GCR or Artifact Registry repository.
+	Project string
+	// Location is the GCP location of a GCR or Artifact Registry repository. (ie: us or europe-west1)
+	Location string
+	// Repository is the Artifact Registry repository, which contains images.
+	Repository string
+	// Name is the name of an ACR registry.
+	Name string
+	// Owner is the user or organization owning the repository, on GHCR, Quay, Docker Hub and ECR
+	// Public.
+	Owner string
+}
+
+// Rule recognizes the registries of a provider.
+type Rule struct {
+	// Provider is the provider of the registries matched by the rule.
+	Provider Provider
+	// Pattern matches the lowercase registry of a reference, followed by a slash and the path of
+	// its repository. (ie: docker.io/library/debian) Its named groups fill the fields of Info:
+	// account, region, fips, project, location, repository, name and owner.
+	Pattern *regexp.Regexp
+	// Complete, if not nil, completes the Info filled by Pattern.
+	Complete func(info *Info)
+}
+
+// DefaultRules recognize the registries of the public clouds and the public registries.
+var DefaultRules = []Rule{
+	{
+		Provider: ECR,
+		Pattern: regexp.MustCompile(`^(?P<account>[0-9]{12})\.dkr\.ecr(?P<fips>-fips)?\.(?P<region>[a-z0-9-]+)\.` +
+			`(?:amazonaws\.com(?:\.cn)?|c2s\.ic\.gov|sc2s\.sgov\.gov)/`),
+		Complete: completeECR,
+	},
+	{
+		Provider: ECRPublic,
+		Pattern:  regexp.MustCompile(`^public\.ecr\.aws/(?P<owner>[^/]+)/`),
+	},
+	{
+		Provider: GCR,
+		Pattern:  regexp.MustCompile(`^(?:(?P<location>us|eu|asia)\.)?gcr\.io/(?P<project>[^/]+)/`),
+		Complete: completeGCR,
+	},
+	{
+		Provider: ArtifactRegistry,
+		Pattern:  regexp.MustCompile(`^(?P<location>[a-z0-9-]+)-docker\.pkg\.dev/(?P<project>[^/]+)/(?P<repository>[^/]+)/`),
+	},
+	{
+		Provider: ACR,
+		Pattern:  regexp.MustCompile(`^(?P<name>[a-z0-9]+)\.azurecr\.(?:io|cn|us)/`),
+	},
+	{
+		Provider: GHCR,
+		Pattern:  regexp.MustCompile(`^ghcr\.io/(?:(?P<owner>[^/]+)/)?`),
+	},
+	{
+		Provider: Quay,
+		Pattern:  regexp.MustCompile(`^quay\.io/(?:(?P<owner>[^/]+)/)?`),
+	},
+	{
+		Provider: DockerHub,
+		Pattern:  regexp.MustCompile(`^docker\.io/(?P<owner>[^/]+)/`),
+	},
+}
+
+// DefaultClassifier is the classifier used by package-level functions.
+var DefaultClassifier = &Classifier{Rules: DefaultRules}
+
+// Classifier classifies references with rules. The first matching rule wins: to recognize other
+// registries, such as self-hosted ones, prepend rules to DefaultRules.
+type Classifier struct {
+	Rules []Rule
+}
+
+// Classify returns the provider of the registry of the reference, and the metadata encoded in its
+// name, or false if no rule matches.
+func (c *Classifier) Classify(ref *dockerparser.Reference) (*Info, bool) {
+
+	registry := strings.ToLower(ref.Registry())
+	target := registry + "/" + ref.RepositoryPath()
+
+	for _, rule := range c.Rules {
+		matches := rule.Pattern.FindStringSubmatch(target)
+		if matches == nil {
+			continue
+		}
+
+		info := &Info{Provider: rule.Provider, Registry: ref.Registry()}
+		for i, group := range rule.Pattern.SubexpNames() {
+			info.set(group, matches[i])
+		}
+		if rule.Complete != nil {
+			rule.Complete(info)
+		}
+
+		return info, true
+	}
+
+	return nil, false
+}
+
+// Classify returns the provider of the registry of the reference with DefaultClassifier.
+func Classify(ref *dockerparser.Reference) (*Info, bool) {
+	return DefaultClassifier.Classify(ref)
+}
+
+func (info *Info) set(group, value string) {
+	switch group {
+	case "account":
+		info.AccountID = value
+	case "region":
+		info.Region = value
+	case "fips":
+		info.FIPS = value != ""
+	case "project":
+		info.Project = value
+	case "location":
+		info.Location = value
+	case "repository":
+		info.Repository = value
+	case "name":
+		info.Name = value
+	case "owner":
+		info.Owner = value
+	}
+}
+
+// completeECR sets the AWS partition from the region.
+func completeECR(info *Info) {
+	switch {
+	case strings.HasPrefix(info.Region, "cn-"):
+		info.Partition = "aws-cn"
+	case strings.HasPrefix(info.Region, "us-gov-"):
+		info.Partition = "aws-us-gov"
+	case strings.HasPrefix(info.Region, "us-isob-"):
+		info.Partition = "aws-iso-b"
+	case strings.HasPrefix(info.Region, "us-iso-"):
+		info.Partition = "aws-iso"
+	default:
+		info.Partition = "aws"
+	}
+}
+
+// completeGCR sets the location of gcr.io, which is hosted in the US.
+func completeGCR(info *Info) {
+	if info.Location == "" {
+		info.Location = "us"
+	}
+}
@@ -0,0 +1,132 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cloud
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/novln/docker-parser/internal/reftest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+
+	is := require.New(t)
+
+	tests := map[string]Info{
+		"123456789012.dkr.ecr.eu-west-1.amazonaws.com/team/app:1.0": {
+			Provider: ECR, Registry: "123456789012.dkr.ecr.eu-west-1.amazonaws.com",
+			AccountID: "123456789012", Region: "eu-west-1", Partition: "aws",
+		},
+		"123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com/app": {
+			Provider: ECR, Registry: "123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com",
+			AccountID: "123456789012", Region: "us-gov-west-1", Partition: "aws-us-gov", FIPS: true,
+		},
+		"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn/app": {
+			Provider: ECR, Registry: "123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn",
+			AccountID: "123456789012", Region: "cn-north-1", Partition: "aws-cn",
+		},
+		"123456789012.dkr.ecr.us-iso-east-1.c2s.ic.gov/app": {
+			Provider: ECR, Registry: "123456789012.dkr.ecr.us-iso-east-1.c2s.ic.gov",
+			AccountID: "123456789012", Region: "us-iso-east-1", Partition: "aws-iso",
+		},
+		"public.ecr.aws/nginx/nginx:latest": {
+			Provider: ECRPublic, Registry: "public.ecr.aws", Owner: "nginx",
+		},
+		"gcr.io/my-project/app": {
+			Provider: GCR, Registry: "gcr.io", Project: "my-project", Location: "us",
+		},
+		"eu.gcr.io/my-project/team/app": {
+			Provider: GCR, Registry: "eu.gcr.io", Project: "my-project", Location: "eu",
+		},
+		"europe-docker.pkg.dev/proj/repo/img": {
+			Provider: ArtifactRegistry, Registry: "europe-docker.pkg.dev", Project: "proj",
+			Location: "europe", Repository: "repo",
+		},
+		"us-central1-docker.pkg.dev/proj/repo/team/img@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb": {
+			Provider: ArtifactRegistry, Registry: "us-central1-docker.pkg.dev", Project: "proj",
+			Location: "us-central1", Repository: "repo",
+		},
+		"myregistry.azurecr.io/team/app": {
+			Provider: ACR, Registry: "myregistry.azurecr.io", Name: "myregistry",
+		},
+		"ghcr.io/novln/docker-parser:1.0": {
+			Provider: GHCR, Registry: "ghcr.io", Owner: "novln",
+		},
+		"quay.io/prometheus/node-exporter": {
+			Provider: Quay, Registry: "quay.io", Owner: "prometheus",
+		},
+		"quay.io/busybox": {
+			Provider: Quay, Registry: "quay.io",
+		},
+		"nginx": {
+			Provider: DockerHub, Registry: "docker.io", Owner: "library",
+		},
+		"index.docker.io/bitnami/redis": {
+			Provider: DockerHub, Registry: "docker.io", Owner: "bitnami",
+		},
+	}
+
+	for remote, expected := range tests {
+		info, ok := Classify(reftest.Parse(t, remote))
+		is.True(ok, "a provider was expected for %s", remote)
+		is.Equal(expected, *info, "unexpected info for %s", remote)
+	}
+
+	unknown := []string{
+		"registry.local:5000/team/app",
+		"12345.dkr.ecr.eu-west-1.amazonaws.com/app",
+		"123456789012.dkr.ecr.eu-west-1.amazonaws.com.evil.com/app",
+		"docker-pkg.dev/proj/repo/img",
+		"gcr.io/app",
+	}
+
+	for _, remote := range unknown {
+		info, ok := Classify(reftest.Parse(t, remote))
+		is.False(ok, "no provider was expected for %s", remote)
+		is.Nil(info)
+	}
+
+}
+
+func TestClassifier(t *testing.T) {
+
+	is := require.New(t)
+
+	harbor := Rule{
+		Provider: "harbor",
+		Pattern:  regexp.MustCompile(`^harbor\.corp/(?P<project>[^/]+)/`),
+		Complete: func(info *Info) {
+			info.Location = "paris"
+		},
+	}
+	classifier := &Classifier{Rules: append([]Rule{harbor}, DefaultRules...)}
+
+	info, ok := classifier.Classify(reftest.Parse(t, "harbor.corp/dockerhub/bitnami/redis"))
+	is.True(ok)
+	is.Equal(&Info{Provider: "harbor", Registry: "harbor.corp", Project: "dockerhub", Location: "paris"}, info)
+
+	info, ok = classifier.Classify(reftest.Parse(t, "ghcr.io/novln/docker-parser"))
+	is.True(ok)
+	is.Equal(GHCR, info.Provider)
+
+	info, ok = (&Classifier{}).Classify(reftest.Parse(t, "nginx"))
+	is.False(ok)
+	is.Nil(info)
+
+}
@@ -0,0 +1,154 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package compose finds and rewrites the image references of a Docker Compose file.
+package compose
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v3"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/internal/yamlsource"
+)
+
+// ErrInvalidFormat is returned when a Compose file isn't a mapping with a services mapping.
+var ErrInvalidFormat = errors.New("invalid compose file format")
+
+// Image is the image reference of a service in a Compose file.
+type Image struct {
+	// Service is the name of the service using the image.
+	Service string
+	// Raw is the reference as written in the Compose file, before interpolation.
+	Raw string
+	// Value is the reference after interpolation.
+	Value string
+	// Line is the line number of the reference, starting at 1.
+	Line int
+	// Column is the column of the reference in its line, starting at 1.
+	Column int
+	// Reference is the parsed reference, if Value is valid.
+	Reference *dockerparser.Reference
+	// Err is the reason why Value couldn't be interpolated or parsed.
+	Err error
+
+	scalar  yamlsource.Scalar
+	located bool
+}
+
+// File is a parsed Compose file.
+type File struct {
+	// Images lists the image references of services, in the order they appear.
+	Images []Image
+	source []byte
+}
+
+// Parse reads a Compose file from r and returns the image references of its services.
+// The given environment is used to interpolate variables.
+func Parse(r io.Reader, env map[string]string) (*File, error) {
+
+	source, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	document := yaml.Node{}
+	err = yaml.Unmarshal(source, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{source: source}
+	if document.Kind == 0 {
+		return file, nil
+	}
+
+	root := &document
+	if root.Kind == yaml.DocumentNode && len(root.Content) == 1 {
+		root = yamlsource.Resolve(root.Content[0])
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, ErrInvalidFormat
+	}
+
+	services := yamlsource.Lookup(root, "services")
+	if services == nil {
+		return file, nil
+	}
+	if services.Kind != yaml.MappingNode {
+		return nil, ErrInvalidFormat
+	}
+
+	src := yamlsource.New(source)
+
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		node := yamlsource.Lookup(services.Content[i+1], "image")
+		if node == nil || node.Kind != yaml.ScalarNode {
+			continue
+		}
+
+		image := Image{
+			Service: services.Content[i].Value,
+			Raw:     node.Value,
+			Line:    node.Line,
+			Column:  node.Column,
+		}
+
+		image.scalar, image.located = src.Locate(node)
+		if image.located {
+			image.Column = image.scalar.Column
+		}
+
+		image.Value, image.Err = interpolate(node.Value, env)
+		if image.Err == nil {
+			image.Reference, image.Err = dockerparser.Parse(image.Value)
+		}
+
+		file.Images = append(file.Images, image)
+	}
+
+	return file, nil
+}
+
+// Bytes returns the content of the Compose file.
+func (f *File) Bytes() []byte {
+	return f.source
+}
+
+// Rewrite returns the content of the Compose file with image references replaced by the result of
+// fn, leaving everything else untouched. It should return the image's Raw value to keep it unchanged.
+// The quoting style of each reference is preserved.
+//
+// An image shared with an alias is rewritten once, using the result for its first service. Images
+// that don't fit on a single line, such as block scalars, are left untouched.
+func (f *File) Rewrite(fn func(image Image) string) []byte {
+
+	edits := []yamlsource.Edit{}
+
+	for _, image := range f.Images {
+		if !image.located {
+			continue
+		}
+		if value := fn(image); value != image.Raw {
+			edits = append(edits, yamlsource.Edit{Scalar: image.scalar, Value: value})
+		}
+	}
+
+	return yamlsource.Apply(f.source, edits)
+}
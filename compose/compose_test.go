@@ -0,0 +1,161 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package compose
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+
+	is := require.New(t)
+
+	file := parseFile(is, map[string]string{"NGINX_VERSION": "1.19"})
+
+	is.Len(file.Images, 5)
+
+	web := file.Images[0]
+	is.Equal("web", web.Service)
+	is.Equal("${REGISTRY:-docker.io}/library/nginx:${NGINX_VERSION}", web.Raw)
+	is.Equal("docker.io/library/nginx:1.19", web.Value)
+	is.Equal(8, web.Line)
+	is.Equal(12, web.Column)
+	is.NoError(web.Err)
+	is.Equal("docker.io/library/nginx:1.19", web.Reference.Remote())
+
+	api := file.Images[1]
+	is.Equal("api", api.Service)
+	is.Equal("localhost:5000/novln/api:latest", api.Reference.Remote())
+	is.Equal(13, api.Line)
+
+	worker := file.Images[2]
+	is.Equal("worker", worker.Service)
+	is.Equal("ghcr.io/novln/base:1.0", worker.Reference.Remote())
+	is.Equal(3, worker.Line)
+	is.Equal(22, worker.Column)
+
+	cron := file.Images[3]
+	is.Equal("cron", cron.Service)
+	is.Equal(worker.Line, cron.Line)
+	is.Equal(worker.Column, cron.Column)
+
+	is.Equal("db", file.Images[4].Service)
+
+}
+
+func TestParseMissingVariable(t *testing.T) {
+
+	is := require.New(t)
+
+	file := parseFile(is, nil)
+
+	is.Error(file.Images[0].Err)
+	is.Nil(file.Images[0].Reference)
+
+}
+
+func TestParseError(t *testing.T) {
+
+	is := require.New(t)
+
+	_, err := Parse(strings.NewReader("- foo\n- bar\n"), nil)
+	is.Equal(ErrInvalidFormat, err)
+
+	_, err = Parse(strings.NewReader("services: [foo]\n"), nil)
+	is.Equal(ErrInvalidFormat, err)
+
+	file, err := Parse(strings.NewReader(""), nil)
+	is.NoError(err)
+	is.Empty(file.Images)
+
+}
+
+func TestRewrite(t *testing.T) {
+
+	is := require.New(t)
+
+	file := parseFile(is, map[string]string{"NGINX_VERSION": "1.19"})
+
+	content := file.Rewrite(func(image Image) string {
+		if image.Service == "db" {
+			return image.Raw
+		}
+		return image.Reference.Repository() + "@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb"
+	})
+
+	expected := strings.NewReplacer(
+		`"ghcr.io/novln/base:1.0"`, `"ghcr.io/novln/base@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb"`,
+		"${REGISTRY:-docker.io}/library/nginx:${NGINX_VERSION}", "docker.io/library/nginx@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb",
+		`'localhost:5000/novln/api'`, `'localhost:5000/novln/api@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb'`,
+	).Replace(string(file.Bytes()))
+
+	is.Equal(expected, string(content))
+
+}
+
+func TestInterpolate(t *testing.T) {
+
+	is := require.New(t)
+
+	env := map[string]string{"A": "a", "EMPTY": ""}
+
+	tests := map[string]string{
+		"$A-${A}":          "a-a",
+		"$$A":              "$A",
+		"${EMPTY:-b}":      "b",
+		"${EMPTY-b}":       "",
+		"${UNSET-b}":       "b",
+		"${A:+b}":          "b",
+		"${UNSET:+b}":      "",
+		"${UNSET:-${A}/c}": "a/c",
+		"${A:?missing}":    "a",
+	}
+
+	for input, expected := range tests {
+		value, err := interpolate(input, env)
+		is.NoError(err)
+		is.Equal(expected, value, "unexpected interpolation of %q", input)
+	}
+
+	for _, input := range []string{"${UNSET:?missing}", "${EMPTY:?}", "${A", "${}", "$-"} {
+		_, err := interpolate(input, env)
+		is.Error(err, "an error was expected for %q", input)
+	}
+
+}
+
+func parseFile(is *require.Assertions, env map[string]string) *File {
+
+	f, err := os.Open("testdata/compose.yaml")
+	is.NoError(err)
+	defer f.Close()
+
+	file, err := Parse(f, env)
+	is.NoError(err)
+	is.NotNil(file)
+
+	source, err := ioutil.ReadFile("testdata/compose.yaml")
+	is.NoError(err)
+	is.Equal(source, file.Bytes())
+
+	return file
+}
@@ -0,0 +1,31 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package compose
+
+import (
+	"github.com/novln/docker-parser/internal/expansion"
+)
+
+// interpolate substitutes the variables in s using the given environment, as specified by Compose:
+// $VAR, ${VAR}, ${VAR:-default}, ${VAR-default}, ${VAR:?error}, ${VAR?error}, ${VAR:+replacement},
+// ${VAR+replacement} and $$ for a literal dollar sign.
+func interpolate(s string, env map[string]string) (string, error) {
+	return expansion.Compose.Expand(s, func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	})
+}
@@ -0,0 +1,126 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package cosign derives the companion references where cosign stores the signatures, attestations
+// and SBOMs of an image, at tags derived from its digest (ie: sha256-<hex>.sig), and recovers the
+// digest of the image from such tags.
+package cosign
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/distribution/digest"
+)
+
+// Suffixes of the companion tags written by cosign.
+const (
+	SuffixSignature   = "sig"
+	SuffixAttestation = "att"
+	SuffixSBOM        = "sbom"
+)
+
+// EnvRepository is the environment variable with which cosign stores companions in another
+// repository than the one of the image.
+const EnvRepository = "COSIGN_REPOSITORY"
+
+// ErrDigestRequired is returned when a companion is requested for a reference without digest.
+var ErrDigestRequired = errors.New("companions require a reference with a digest")
+
+// Tag returns the companion tag of the digest with the given suffix. (ie: sha256-<hex>.sig)
+func Tag(d digest.Digest, suffix string) string {
+	return strings.Replace(d.String(), ":", "-", 1) + "." + suffix
+}
+
+// ParseTag returns the digest and the suffix of a companion tag, or false if the tag isn't one.
+func ParseTag(tag string) (digest.Digest, string, bool) {
+
+	i := strings.LastIndexByte(tag, '.')
+	j := strings.IndexByte(tag, '-')
+	if i == -1 || j == -1 || j > i || i == len(tag)-1 {
+		return "", "", false
+	}
+
+	d := digest.Digest(tag[:j] + ":" + tag[j+1:i])
+	if d.Validate() != nil {
+		return "", "", false
+	}
+
+	return d, tag[i+1:], true
+}
+
+// Companion returns the reference of the companion of an image identified by a digest, with the
+// given suffix, in the given repository or in the repository of the image if it's empty. Digests
+// whose companion tags exceed the length limit of tags, such as sha512 ones, return an error.
+func Companion(ref *dockerparser.Reference, suffix, repository string) (*dockerparser.Reference, error) {
+
+	if !ref.HasDigest() {
+		return nil, fmt.Errorf("%s: %s", ref.Remote(), ErrDigestRequired)
+	}
+	if repository == "" {
+		repository = ref.Repository()
+	}
+
+	companion, err := dockerparser.Parse(repository + ":" + Tag(digest.Digest(ref.Tag()), suffix))
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid companion: %s", ref.Remote(), err)
+	}
+
+	return companion, nil
+}
+
+// Signature returns the reference of the signatures of an image identified by a digest, in the
+// repository given by COSIGN_REPOSITORY if it's set.
+func Signature(ref *dockerparser.Reference) (*dockerparser.Reference, error) {
+	return Companion(ref, SuffixSignature, os.Getenv(EnvRepository))
+}
+
+// Attestation returns the reference of the attestations of an image identified by a digest, in the
+// repository given by COSIGN_REPOSITORY if it's set.
+func Attestation(ref *dockerparser.Reference) (*dockerparser.Reference, error) {
+	return Companion(ref, SuffixAttestation, os.Getenv(EnvRepository))
+}
+
+// SBOM returns the reference of the SBOM of an image identified by a digest, in the repository
+// given by COSIGN_REPOSITORY if it's set.
+func SBOM(ref *dockerparser.Reference) (*dockerparser.Reference, error) {
+	return Companion(ref, SuffixSBOM, os.Getenv(EnvRepository))
+}
+
+// Subject returns the reference of the image of a companion, identified by its digest, and the
+// suffix of the companion, or false if the reference isn't a companion. The image is assumed to be
+// in the repository of the companion, which doesn't hold if the companion was stored elsewhere.
+func Subject(companion *dockerparser.Reference) (*dockerparser.Reference, string, bool) {
+
+	if companion.HasDigest() {
+		return nil, "", false
+	}
+
+	d, suffix, ok := ParseTag(companion.Tag())
+	if !ok {
+		return nil, "", false
+	}
+
+	subject, err := companion.WithDigest(d)
+	if err != nil {
+		return nil, "", false
+	}
+
+	return subject, suffix, true
+}
@@ -0,0 +1,148 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cosign
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/novln/docker-parser/distribution/digest"
+	"github.com/novln/docker-parser/internal/reftest"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testHex    = "bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb"
+	testDigest = "sha256:" + testHex
+)
+
+func TestTag(t *testing.T) {
+
+	is := require.New(t)
+
+	is.Equal("sha256-"+testHex+".sig", Tag(testDigest, SuffixSignature))
+
+	d, suffix, ok := ParseTag("sha256-" + testHex + ".att")
+	is.True(ok)
+	is.Equal(digest.Digest(testDigest), d)
+	is.Equal(SuffixAttestation, suffix)
+
+	_, _, ok = ParseTag("sha256-" + testHex + ".custom.sig")
+	is.False(ok)
+
+	invalid := []string{
+		"latest",
+		"1.0.2",
+		"sha256-" + testHex,
+		"sha256-" + testHex + ".",
+		"sha256-" + testHex[:10] + ".sig",
+		"md5-d41d8cd98f00b204e9800998ecf8427e.sig",
+		"v1-" + testHex + ".sig",
+	}
+
+	for _, tag := range invalid {
+		d, suffix, ok := ParseTag(tag)
+		is.False(ok, "no companion was expected for %s", tag)
+		is.Empty(d)
+		is.Empty(suffix)
+	}
+
+}
+
+func TestCompanion(t *testing.T) {
+
+	is := require.New(t)
+
+	ref := reftest.Parse(t, "ghcr.io/team/app@"+testDigest)
+
+	companion, err := Companion(ref, "sbom", "")
+	is.NoError(err)
+	is.Equal("ghcr.io/team/app:sha256-"+testHex+".sbom", companion.Remote())
+
+	companion, err = Companion(ref, SuffixSignature, "registry.local/signatures")
+	is.NoError(err)
+	is.Equal("registry.local/signatures:sha256-"+testHex+".sig", companion.Remote())
+
+	companion, err = Companion(reftest.Parse(t, "ghcr.io/team/app:1.0"), SuffixSignature, "")
+	is.Error(err)
+	is.Contains(err.Error(), ErrDigestRequired.Error())
+	is.Nil(companion)
+
+	companion, err = Companion(ref, SuffixSignature, "Invalid")
+	is.Error(err)
+	is.Nil(companion)
+
+	sha512 := reftest.Parse(t, "ghcr.io/team/app@sha512:"+strings.Repeat("a", 128))
+	companion, err = Companion(sha512, SuffixSignature, "")
+	is.Error(err)
+	is.Nil(companion)
+
+}
+
+func TestEnvRepository(t *testing.T) {
+
+	is := require.New(t)
+
+	previous, ok := os.LookupEnv(EnvRepository)
+	defer func() {
+		if ok {
+			os.Setenv(EnvRepository, previous)
+		} else {
+			os.Unsetenv(EnvRepository)
+		}
+	}()
+
+	ref := reftest.Parse(t, "nginx@"+testDigest)
+
+	is.NoError(os.Unsetenv(EnvRepository))
+	signature, err := Signature(ref)
+	is.NoError(err)
+	is.Equal("docker.io/library/nginx:sha256-"+testHex+".sig", signature.Remote())
+
+	is.NoError(os.Setenv(EnvRepository, "registry.local/cosign"))
+	signature, err = Signature(ref)
+	is.NoError(err)
+	is.Equal("registry.local/cosign:sha256-"+testHex+".sig", signature.Remote())
+
+	attestation, err := Attestation(ref)
+	is.NoError(err)
+	is.Equal("registry.local/cosign:sha256-"+testHex+".att", attestation.Remote())
+
+	sbom, err := SBOM(ref)
+	is.NoError(err)
+	is.Equal("registry.local/cosign:sha256-"+testHex+".sbom", sbom.Remote())
+
+}
+
+func TestSubject(t *testing.T) {
+
+	is := require.New(t)
+
+	subject, suffix, ok := Subject(reftest.Parse(t, "ghcr.io/team/app:sha256-"+testHex+".sig"))
+	is.True(ok)
+	is.Equal("ghcr.io/team/app@"+testDigest, subject.Remote())
+	is.Equal(SuffixSignature, suffix)
+
+	for _, remote := range []string{"ghcr.io/team/app:1.0", "ghcr.io/team/app@" + testDigest, "ghcr.io/team/app"} {
+		subject, suffix, ok := Subject(reftest.Parse(t, remote))
+		is.False(ok, "no subject was expected for %s", remote)
+		is.Nil(subject)
+		is.Empty(suffix)
+	}
+
+}
@@ -0,0 +1,288 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package credentials finds the credentials of a registry in the configuration file of the Docker
+// CLI (ie: ~/.docker/config.json), either stored in it or in a credential helper.
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/docker"
+	"github.com/novln/docker-parser/registry"
+)
+
+// IndexServer is the key of Docker Hub credentials in configuration files and credential helpers.
+const IndexServer = "https://index.docker.io/v1/"
+
+// helperPrefix is the prefix of the executables of credential helpers.
+const helperPrefix = "docker-credential-"
+
+// tokenUsername is the username returned by credential helpers for identity tokens.
+const tokenUsername = "<token>"
+
+// AuthConfig is an entry of the auths section of a configuration file.
+type AuthConfig struct {
+	// Auth is the base64 encoding of "username:password".
+	Auth          string `json:"auth,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+// Config is the configuration file of the Docker CLI, restricted to credentials.
+type Config struct {
+	// Auths maps registries to their credentials. Keys may be URLs, such as IndexServer.
+	Auths map[string]AuthConfig `json:"auths,omitempty"`
+	// CredsStore is the credential helper storing the credentials of every registry.
+	// (ie: "desktop" for docker-credential-desktop)
+	CredsStore string `json:"credsStore,omitempty"`
+	// CredHelpers maps registries to the credential helper storing their credentials.
+	CredHelpers map[string]string `json:"credHelpers,omitempty"`
+}
+
+// Load reads a configuration file.
+func Load(r io.Reader) (*Config, error) {
+
+	config := &Config{}
+	if err := json.NewDecoder(r).Decode(config); err != nil {
+		return nil, fmt.Errorf("invalid docker configuration: %s", err)
+	}
+
+	return config, nil
+}
+
+// LoadFile reads the configuration file at the given path. A missing file gives an empty
+// configuration.
+func LoadFile(path string) (*Config, error) {
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Load(file)
+}
+
+// LoadDefault reads the configuration file of the current user.
+func LoadDefault() (*Config, error) {
+	return LoadFile(DefaultPath())
+}
+
+// DefaultPath returns the path of the configuration file of the current user: config.json in the
+// DOCKER_CONFIG directory if it's defined, in ~/.docker otherwise.
+func DefaultPath() string {
+
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".docker", "config.json")
+	}
+
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// Lookup returns the credentials of the given registry, as host[:port], or nil if there are none.
+// It can be used as the registry.CredentialsFunc of a registry.Transport. The context bounds the
+// execution of credential helpers.
+//
+// A credential helper configured for the registry in CredHelpers, or else CredsStore, is used
+// first. If it doesn't know the registry, the credentials stored in Auths are used. When several
+// keys designate the registry, the server URL used by credential helpers wins, then the registry
+// itself, then the first key in lexical order.
+func (c *Config) Lookup(ctx context.Context, host string) (*registry.Credentials, error) {
+
+	host = normalize(host)
+
+	helpers := make([]string, 0, len(c.CredHelpers))
+	for key := range c.CredHelpers {
+		helpers = append(helpers, key)
+	}
+	helper := ""
+	if key, ok := find(host, helpers); ok {
+		helper = c.CredHelpers[key]
+	}
+	if helper == "" {
+		helper = c.CredsStore
+	}
+
+	if helper != "" {
+		credentials, err := Get(ctx, helper, serverURL(host))
+		if err != nil || credentials != nil {
+			return credentials, err
+		}
+	}
+
+	auths := make([]string, 0, len(c.Auths))
+	for key := range c.Auths {
+		auths = append(auths, key)
+	}
+	if key, ok := find(host, auths); ok {
+		return c.Auths[key].credentials(host)
+	}
+
+	return nil, nil
+}
+
+// find returns the key of the configuration file designating the given registry: its server URL
+// or the registry itself if one of them is a key, or else the first of the keys normalized to it in
+// lexical order, so that the result doesn't depend on the iteration order of maps.
+func find(host string, keys []string) (string, bool) {
+
+	sort.Strings(keys)
+
+	exact, found := "", ""
+	for _, key := range keys {
+		switch {
+		case key == serverURL(host):
+			return key, true
+		case key == host:
+			exact = key
+		case found == "" && normalize(key) == host:
+			found = key
+		}
+	}
+
+	if exact != "" {
+		return exact, true
+	}
+
+	return found, found != ""
+}
+
+// LookupReference returns the credentials of the registry of the reference, or nil if there are
+// none.
+func (c *Config) LookupReference(ctx context.Context, ref *dockerparser.Reference) (*registry.Credentials, error) {
+	return c.Lookup(ctx, ref.Registry())
+}
+
+func (a AuthConfig) credentials(host string) (*registry.Credentials, error) {
+
+	credentials := &registry.Credentials{
+		Username:      a.Username,
+		Password:      a.Password,
+		IdentityToken: a.IdentityToken,
+	}
+
+	if a.Auth != "" {
+		decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth of %s: %s", host, err)
+		}
+		i := bytes.IndexByte(decoded, ':')
+		if i == -1 {
+			return nil, fmt.Errorf("invalid auth of %s: missing password", host)
+		}
+		credentials.Username, credentials.Password = string(decoded[:i]), string(decoded[i+1:])
+	}
+
+	if *credentials == (registry.Credentials{}) {
+		return nil, nil
+	}
+
+	return credentials, nil
+}
+
+// Get returns the credentials of the given server URL stored in the credential helper, by running
+// "docker-credential-<helper> get". It returns nil if the helper doesn't know the server. The helper
+// is killed if the context is done before it exits.
+func Get(ctx context.Context, helper, server string) (*registry.Credentials, error) {
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, helperPrefix+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stdout.String())
+		if message == "" {
+			message = strings.TrimSpace(stderr.String())
+		}
+		if isNotFound(message) {
+			return nil, nil
+		}
+		if message != "" {
+			return nil, fmt.Errorf("credential helper %s failed: %s", helper, message)
+		}
+		return nil, fmt.Errorf("credential helper %s failed: %s", helper, err)
+	}
+
+	output := struct {
+		ServerURL string `json:"ServerURL"`
+		Username  string `json:"Username"`
+		Secret    string `json:"Secret"`
+	}{}
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, fmt.Errorf("invalid output of credential helper %s: %s", helper, err)
+	}
+
+	if output.Username == tokenUsername {
+		return &registry.Credentials{IdentityToken: output.Secret}, nil
+	}
+
+	return &registry.Credentials{Username: output.Username, Password: output.Secret}, nil
+}
+
+// isNotFound returns true if the message of a credential helper means it doesn't know the server.
+func isNotFound(message string) bool {
+	return strings.Contains(strings.ToLower(message), "credentials not found")
+}
+
+// normalize returns the registry of a key of the configuration file, which may be a URL.
+// (ie: https://index.docker.io/v1/ gives docker.io)
+func normalize(key string) string {
+
+	key = strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+	if i := strings.IndexByte(key, '/'); i != -1 {
+		key = key[:i]
+	}
+	key = strings.ToLower(key)
+
+	switch key {
+	case docker.LegacyDefaultHostname, registry.DockerHubEndpoint:
+		return docker.DefaultHostname
+	}
+
+	return key
+}
+
+// serverURL returns the server URL of a registry used by credential helpers, which is IndexServer
+// for Docker Hub.
+func serverURL(host string) string {
+	if host == docker.DefaultHostname {
+		return IndexServer
+	}
+	return host
+}
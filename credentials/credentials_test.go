@@ -0,0 +1,181 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package credentials
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/registry"
+	"github.com/stretchr/testify/require"
+)
+
+// withFakeHelper adds the stand-in credential helper of testdata to the PATH.
+func withFakeHelper(t *testing.T) {
+
+	dir, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+	require.NoError(t, os.Chmod(filepath.Join(dir, "docker-credential-fake"), 0755))
+
+	path := os.Getenv("PATH")
+	require.NoError(t, os.Setenv("PATH", dir+string(os.PathListSeparator)+path))
+	t.Cleanup(func() {
+		_ = os.Setenv("PATH", path)
+	})
+
+}
+
+func TestLookup(t *testing.T) {
+
+	is := require.New(t)
+	ctx := context.Background()
+	withFakeHelper(t)
+
+	config, err := LoadFile(filepath.Join("testdata", "config.json"))
+	is.NoError(err)
+
+	tests := map[string]*registry.Credentials{
+		"nginx":                               {Username: "hubuser", Password: "hubpass"},
+		"index.docker.io/team/app":            {Username: "hubuser", Password: "hubpass"},
+		"registry.local:5000/team/app:1.0":    {Username: "team", Password: "s3cr3t"},
+		"quay.io/org/app":                     {Username: "robot", Password: "tok:en"},
+		"azure.azurecr.io/app":                {IdentityToken: "refresh-token"},
+		"gcr.io/project/app":                  {Username: "oauth2accesstoken", Password: "gcr-token"},
+		"private.example.com/app":             {IdentityToken: "identity"},
+		"ghcr.io/org/app":                     nil,
+		"registry.local/team/app":             nil,
+		"unknown.example.com:5000/foo/bar:v1": nil,
+	}
+
+	for remote, expected := range tests {
+		ref, err := dockerparser.Parse(remote)
+		is.NoError(err)
+
+		credentials, err := config.LookupReference(ctx, ref)
+		is.NoError(err, "lookup error was not expected for %s", remote)
+		is.Equal(expected, credentials, "unexpected credentials for %s", remote)
+	}
+
+	_, err = config.Lookup(ctx, "broken.local")
+	is.Error(err)
+
+}
+
+func TestCredsStore(t *testing.T) {
+
+	is := require.New(t)
+	ctx := context.Background()
+	withFakeHelper(t)
+
+	config, err := Load(strings.NewReader(`{
+		"auths": {"https://index.docker.io/v1/": {}, "registry.local:5000": {"auth": "dGVhbTpzM2NyM3Q="}},
+		"credsStore": "fake",
+		"credHelpers": {"fail.local": "fake", "slow.local": "fake"}
+	}`))
+	is.NoError(err)
+
+	credentials, err := config.Lookup(ctx, "docker.io")
+	is.NoError(err)
+	is.Equal(&registry.Credentials{Username: "storeuser", Password: "storepass"}, credentials)
+
+	credentials, err = config.Lookup(ctx, "registry.local:5000")
+	is.NoError(err)
+	is.Equal(&registry.Credentials{Username: "team", Password: "s3cr3t"}, credentials)
+
+	credentials, err = config.Lookup(ctx, "fail.local")
+	is.Error(err)
+	is.Contains(err.Error(), "helper is broken")
+	is.Nil(credentials)
+
+	timeout, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	credentials, err = config.Lookup(timeout, "slow.local")
+	is.Error(err)
+	is.Nil(credentials)
+	is.True(time.Since(start) < 5*time.Second)
+
+	config.CredsStore = "missing"
+	credentials, err = config.Lookup(ctx, "docker.io")
+	is.Error(err)
+	is.Nil(credentials)
+
+}
+
+func TestLookupPrecedence(t *testing.T) {
+
+	is := require.New(t)
+	ctx := context.Background()
+
+	config, err := Load(strings.NewReader(`{
+		"auths": {
+			"docker.io": {"username": "short", "password": "pass"},
+			"https://index.docker.io/v1/": {"username": "index", "password": "pass"},
+			"index.docker.io": {"username": "legacy", "password": "pass"},
+			"https://registry.local:5000/v2/": {"username": "url", "password": "pass"},
+			"http://registry.local:5000": {"username": "http", "password": "pass"},
+			"quay.io": {"username": "exact", "password": "pass"},
+			"https://quay.io": {"username": "url", "password": "pass"}
+		}
+	}`))
+	is.NoError(err)
+
+	tests := map[string]string{
+		"docker.io":           "index",
+		"registry.local:5000": "http",
+		"quay.io":             "exact",
+	}
+
+	for i := 0; i < 10; i++ {
+		for host, expected := range tests {
+			credentials, err := config.Lookup(ctx, host)
+			is.NoError(err)
+			is.Equal(expected, credentials.Username, "unexpected credentials for %s", host)
+		}
+	}
+
+}
+
+func TestLoad(t *testing.T) {
+
+	is := require.New(t)
+
+	config, err := LoadFile(filepath.Join("testdata", "missing.json"))
+	is.NoError(err)
+	is.Equal(&Config{}, config)
+
+	config, err = Load(strings.NewReader(`{"auths": []}`))
+	is.Error(err)
+	is.Nil(config)
+
+	dir := os.Getenv("DOCKER_CONFIG")
+	defer os.Setenv("DOCKER_CONFIG", dir)
+
+	is.NoError(os.Setenv("DOCKER_CONFIG", "testdata"))
+	is.Equal(filepath.Join("testdata", "config.json"), DefaultPath())
+
+	config, err = LoadDefault()
+	is.NoError(err)
+	is.Len(config.Auths, 6)
+	is.Equal("fake", config.CredHelpers["gcr.io"])
+
+}
@@ -0,0 +1,188 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package daemon reads the registry settings of the Docker daemon configuration
+// (ie: /etc/docker/daemon.json), in order to know how a host would pull a reference: from which
+// mirrors, and whether its registry is insecure.
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/docker"
+)
+
+// DefaultPath is the path of the configuration file of the Docker daemon on Linux.
+const DefaultPath = "/etc/docker/daemon.json"
+
+// loopback is the range of registries the Docker daemon always considers insecure.
+const loopback = "127.0.0.0/8"
+
+// Config is the configuration of the Docker daemon, restricted to registry settings.
+type Config struct {
+	// RegistryMirrors are the URLs of the mirrors of Docker Hub, such as https://mirror.gcr.io.
+	RegistryMirrors []string `json:"registry-mirrors,omitempty"`
+	// InsecureRegistries are the registries accessed with plain HTTP or unverified TLS
+	// certificates, as host[:port] or CIDR ranges such as 10.0.0.0/8.
+	InsecureRegistries []string `json:"insecure-registries,omitempty"`
+}
+
+// Load reads a configuration of the Docker daemon.
+func Load(r io.Reader) (*Config, error) {
+
+	config := &Config{}
+	if err := json.NewDecoder(r).Decode(config); err != nil {
+		return nil, fmt.Errorf("invalid daemon configuration: %s", err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid daemon configuration: %s", err)
+	}
+
+	return config, nil
+}
+
+// LoadFile reads the configuration of the Docker daemon at the given path. A missing file gives an
+// empty configuration.
+func LoadFile(path string) (*Config, error) {
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Load(file)
+}
+
+// Validate checks the mirrors and insecure registries like the Docker daemon does.
+func (c *Config) Validate() error {
+
+	for _, mirror := range c.RegistryMirrors {
+		if _, err := normalizeMirror(mirror); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range c.InsecureRegistries {
+		if entry == "" || strings.Contains(entry, "://") {
+			return fmt.Errorf("invalid insecure registry %q: it must be host[:port] or a CIDR range", entry)
+		}
+		if strings.Contains(entry, "/") {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return fmt.Errorf("invalid insecure registry %q: %s", entry, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// MirrorsFor returns the URLs of the mirrors the reference is pulled from, in order, before its
+// registry. Like the Docker daemon, mirrors only apply to Docker Hub references. Invalid mirrors
+// are ignored.
+func (c *Config) MirrorsFor(ref *dockerparser.Reference) []string {
+
+	mirrors := []string{}
+	if ref.Registry() != docker.DefaultHostname {
+		return mirrors
+	}
+
+	for _, mirror := range c.RegistryMirrors {
+		if normalized, err := normalizeMirror(mirror); err == nil {
+			mirrors = append(mirrors, normalized)
+		}
+	}
+
+	return mirrors
+}
+
+// IsInsecure returns true if the registry of the reference is insecure, like the Docker daemon
+// decides it:
+//
+//   - Docker Hub is never insecure,
+//   - a registry listed as host[:port] is insecure, with the same port,
+//   - a registry with an IP address is insecure if the address belongs to a listed CIDR range,
+//     whatever its port, or to 127.0.0.0/8,
+//   - localhost is insecure, whatever its port, as a loopback address.
+//
+// Unlike the Docker daemon, hostnames aren't resolved to be matched against CIDR ranges.
+func (c *Config) IsInsecure(ref *dockerparser.Reference) bool {
+	return c.isInsecure(ref.Registry())
+}
+
+func (c *Config) isInsecure(registry string) bool {
+
+	if registry == docker.DefaultHostname {
+		return false
+	}
+
+	for _, entry := range c.InsecureRegistries {
+		if !strings.Contains(entry, "/") && strings.EqualFold(entry, registry) {
+			return true
+		}
+	}
+
+	host := registry
+	if h, _, err := net.SplitHostPort(registry); err == nil {
+		host = h
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	if ip == nil {
+		return false
+	}
+
+	for _, entry := range append([]string{loopback}, c.InsecureRegistries...) {
+		if !strings.Contains(entry, "/") {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeMirror validates a mirror URL, and returns it with a trailing slash.
+func normalizeMirror(mirror string) (string, error) {
+
+	u, err := url.Parse(mirror)
+	if err != nil {
+		return "", fmt.Errorf("invalid mirror %q: %s", mirror, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("invalid mirror %q: unsupported scheme %q", mirror, u.Scheme)
+	}
+	if u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", fmt.Errorf("invalid mirror %q: it must be a scheme and a host, without path", mirror)
+	}
+
+	return u.Scheme + "://" + u.Host + "/", nil
+}
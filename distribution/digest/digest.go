@@ -33,6 +33,12 @@ func NewDigestFromBytes(alg Algorithm, p []byte) Digest {
 	return Digest(fmt.Sprintf("%s:%x", alg, p))
 }
 
+// FromBytes digests the input and returns a Digest with the canonical
+// algorithm.
+func FromBytes(p []byte) Digest {
+	return Canonical.FromBytes(p)
+}
+
 // DigestRegexp matches valid digest types.
 var DigestRegexp = regexp.MustCompile(`[a-zA-Z0-9-_+.]+:[a-fA-F0-9]+`)
 
@@ -90,6 +96,28 @@ func (d Digest) Validate() error {
 	return nil
 }
 
+// Algorithm returns the algorithm portion of the digest. This will panic if
+// the underlying digest is not in a valid format.
+func (d Digest) Algorithm() Algorithm {
+	return Algorithm(d[:d.sepIndex()])
+}
+
+// Hex returns the hex digest portion of the digest. This will panic if the
+// underlying digest is not in a valid format.
+func (d Digest) Hex() string {
+	return string(d[d.sepIndex()+1:])
+}
+
 func (d Digest) String() string {
 	return string(d)
 }
+
+func (d Digest) sepIndex() int {
+	i := strings.Index(string(d), ":")
+
+	if i < 0 {
+		panic(fmt.Sprintf("no ':' separator in digest %q", d))
+	}
+
+	return i
+}
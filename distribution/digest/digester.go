@@ -4,6 +4,11 @@ import (
 	"crypto"
 	"fmt"
 	"hash"
+
+	// Register the hash functions of the supported algorithms, so that they
+	// are available to every importer of the digest package.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
 )
 
 // Algorithm identifies and implementation of a digester by an identifier.
@@ -77,9 +82,9 @@ func (a Algorithm) New() Digester {
 func (a Algorithm) Hash() hash.Hash {
 	if !a.Available() {
 		// NOTE(stevvooe): A missing hash is usually a programming error that
-		// must be resolved at compile time. We don't import in the digest
-		// package to allow users to choose their hash implementation (such as
-		// when using stevvooe/resumable or a hardware accelerated package).
+		// must be resolved at compile time. The digest package imports the
+		// implementations of SHA256, SHA384 and SHA512 itself, so only other
+		// algorithms must be imported by users.
 		//
 		// Applications that may want to resolve the hash at runtime should
 		// call Algorithm.Available before call Algorithm.Hash().
@@ -89,6 +94,22 @@ func (a Algorithm) Hash() hash.Hash {
 	return algorithms[a].New()
 }
 
+// FromBytes digests the input and returns a Digest.
+func (a Algorithm) FromBytes(p []byte) Digest {
+	digester := a.New()
+
+	if _, err := digester.Hash().Write(p); err != nil {
+		// Writes to a Hash should never fail. None of the existing
+		// hash implementations in the stdlib or hashes vendored
+		// here can return errors from Write. Having a panic in this
+		// condition instead of having FromBytes return an error value
+		// avoids unnecessary error handling paths in all callers.
+		panic("write to hash function returned error: " + err.Error())
+	}
+
+	return digester.Digest()
+}
+
 // TODO(stevvooe): Allow resolution of verifiers using the digest type and
 // this registration system.
 
@@ -0,0 +1,490 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package dockerfile finds and rewrites the image references of a Dockerfile.
+//
+// It understands enough of the Dockerfile syntax to locate every image used by a build: FROM
+// instructions, COPY --from flags and RUN --mount flags, with ARG substitution, line continuations,
+// comments, heredocs and the escape parser directive.
+package dockerfile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	dockerparser "github.com/novln/docker-parser"
+)
+
+// Kind describes what an image reference of a Dockerfile refers to.
+type Kind int
+
+const (
+	// KindImage is an image pulled from a registry.
+	KindImage Kind = iota
+	// KindStage is a previous build stage, referenced by name or index.
+	KindStage
+	// KindScratch is the reserved, empty, scratch image.
+	KindScratch
+)
+
+// Image is an image reference found in a Dockerfile.
+type Image struct {
+	// Instruction is the instruction using the reference: FROM, COPY or RUN.
+	Instruction string
+	// Kind describes what the reference refers to.
+	Kind Kind
+	// Raw is the reference as written in the Dockerfile, before ARG substitution.
+	Raw string
+	// Value is the reference after ARG substitution.
+	Value string
+	// Offset is the byte offset of Raw in the Dockerfile.
+	Offset int
+	// End is the byte offset right after Raw in the Dockerfile. It's greater than Offset + len(Raw)
+	// if Raw is split by line continuations.
+	End int
+	// Line is the line number of Raw, starting at 1.
+	Line int
+	// Column is the byte column of Raw in its line, starting at 1.
+	Column int
+	// Platform is the value of the --platform flag of a FROM instruction, as written.
+	Platform string
+	// Stage is the name given to the build stage of a FROM instruction with AS.
+	Stage string
+	// Reference is the parsed reference, if Kind is KindImage and Value is valid.
+	Reference *dockerparser.Reference
+	// Err is the reason why Value couldn't be parsed, if Kind is KindImage.
+	Err error
+}
+
+// File is a parsed Dockerfile.
+type File struct {
+	// Images lists the image references in the order they appear.
+	Images []Image
+	source []byte
+}
+
+// Parse reads a Dockerfile from r and returns its image references.
+// The given build arguments override the default values of ARG instructions.
+func Parse(r io.Reader, args map[string]string) (*File, error) {
+
+	source, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{
+		source: source,
+		escape: '\\',
+		args:   args,
+		global: map[string]string{},
+		file:   &File{source: source},
+	}
+
+	err = p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.file, nil
+}
+
+// Bytes returns the content of the Dockerfile.
+func (f *File) Bytes() []byte {
+	return f.source
+}
+
+// Rewrite returns the content of the Dockerfile with image references replaced by the result of fn,
+// leaving everything else untouched. It's only called for references of kind KindImage, and should
+// return the image's Raw value to keep it unchanged. References split by line continuations are
+// replaced with their continuations.
+func (f *File) Rewrite(fn func(image Image) string) []byte {
+
+	b := bytes.Buffer{}
+	last := 0
+
+	for _, image := range f.Images {
+		if image.Kind != KindImage {
+			continue
+		}
+		b.Write(f.source[last:image.Offset])
+		b.WriteString(fn(image))
+		last = image.End
+	}
+	b.Write(f.source[last:])
+
+	return b.Bytes()
+}
+
+// instruction is a logical line of a Dockerfile: physical lines joined by continuations, with a
+// mapping from each byte to its offset in the source.
+type instruction struct {
+	text    string
+	offsets []int
+	line    int
+}
+
+// token is a whitespace separated word of an instruction.
+type token struct {
+	text  string
+	start int
+}
+
+type parser struct {
+	source []byte
+	escape byte
+	args   map[string]string
+	// global holds the ARG declared before the first FROM.
+	global map[string]string
+	// scope holds the ARG declared in the current build stage.
+	scope  map[string]string
+	stages []string
+	file   *File
+}
+
+// bom is the UTF-8 byte order mark, which is ignored at the start of a Dockerfile.
+const bom = "\xef\xbb\xbf"
+
+var (
+	directiveRegexp = regexp.MustCompile(`^#\s*([a-zA-Z][a-zA-Z0-9]*)\s*=\s*(.+?)\s*$`)
+	heredocRegexp   = regexp.MustCompile(`<<(-?)(["']?)([a-zA-Z_][a-zA-Z0-9_]*)(["']?)`)
+)
+
+func (p *parser) parse() error {
+
+	content, offset := string(p.source), 0
+	if strings.HasPrefix(content, bom) {
+		content, offset = content[len(bom):], len(bom)
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	directives := true
+	current := (*instruction)(nil)
+
+	for i := 0; i < len(lines); i++ {
+		raw := lines[i]
+		start := offset
+		offset += len(raw)
+		text := strings.TrimRight(raw, "\r\n")
+		trimmed := strings.TrimSpace(text)
+
+		if directives {
+			if m := directiveRegexp.FindStringSubmatch(text); m != nil {
+				if strings.ToLower(m[1]) == "escape" {
+					if m[2] != "\\" && m[2] != "`" {
+						return fmt.Errorf("line %d: invalid escape character %q", i+1, m[2])
+					}
+					p.escape = m[2][0]
+				}
+				continue
+			}
+			directives = false
+		}
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if current == nil {
+			current = &instruction{line: i + 1}
+		}
+
+		continued := false
+		if t := strings.TrimRight(text, " \t"); strings.HasSuffix(t, string(p.escape)) {
+			text, continued = t[:len(t)-1], true
+		}
+
+		current.text += text
+		for j := range text {
+			current.offsets = append(current.offsets, start+j)
+		}
+
+		if continued {
+			continue
+		}
+
+		err := p.handle(current)
+		if err != nil {
+			return err
+		}
+
+		i = p.skipHeredocs(current, lines, i, &offset)
+		current = nil
+	}
+
+	if current != nil {
+		return p.handle(current)
+	}
+
+	return nil
+}
+
+// skipHeredocs skips the content of the heredocs opened by the given instruction, and returns the
+// index of the last skipped line.
+func (p *parser) skipHeredocs(current *instruction, lines []string, i int, offset *int) int {
+
+	name := strings.ToUpper(firstWord(current.text))
+	if name != "RUN" && name != "COPY" && name != "ADD" {
+		return i
+	}
+
+	for _, m := range heredocRegexp.FindAllStringSubmatch(current.text, -1) {
+		for i+1 < len(lines) {
+			i++
+			*offset += len(lines[i])
+			line := strings.TrimRight(lines[i], "\r\n")
+			if m[1] == "-" {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == m[3] {
+				break
+			}
+		}
+	}
+
+	return i
+}
+
+func (p *parser) handle(current *instruction) error {
+
+	tokens := tokenize(current.text)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	name := strings.ToUpper(tokens[0].text)
+	flags, args := splitFlags(tokens[1:])
+
+	switch name {
+	case "ARG":
+		p.declare(args)
+	case "FROM":
+		return p.handleFrom(current, flags, args)
+	case "COPY":
+		for _, flag := range flags {
+			if strings.HasPrefix(flag.text, "--from=") {
+				p.addSource(current, name, token{
+					text:  flag.text[len("--from="):],
+					start: flag.start + len("--from="),
+				})
+			}
+		}
+	case "RUN":
+		for _, flag := range flags {
+			if strings.HasPrefix(flag.text, "--mount=") {
+				if from, ok := mountFrom(flag); ok {
+					p.addSource(current, name, from)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *parser) handleFrom(current *instruction, flags, args []token) error {
+
+	if len(args) != 1 && !(len(args) == 3 && strings.EqualFold(args[1].text, "AS")) {
+		return fmt.Errorf("line %d: FROM requires an image and an optional stage name", current.line)
+	}
+
+	// FROM instructions only see the ARG declared before the first FROM.
+	value, err := p.expand(args[0].text, p.global)
+	if err != nil {
+		return fmt.Errorf("line %d: %s", current.line, err)
+	}
+
+	image := p.newImage(current, "FROM", args[0], value)
+
+	for _, flag := range flags {
+		if strings.HasPrefix(flag.text, "--platform=") {
+			image.Platform = flag.text[len("--platform="):]
+		}
+	}
+
+	if len(args) == 3 {
+		image.Stage = strings.ToLower(args[2].text)
+	}
+
+	p.file.Images = append(p.file.Images, image)
+	p.stages = append(p.stages, image.Stage)
+	p.scope = map[string]string{}
+
+	return nil
+}
+
+// addSource adds the image reference of a COPY --from or RUN --mount flag, which may also be the
+// name or the index of a previous build stage.
+func (p *parser) addSource(current *instruction, name string, from token) {
+
+	if from.text == "" {
+		return
+	}
+
+	value, err := p.expand(from.text, p.scope)
+	if err != nil {
+		value = from.text
+	}
+
+	image := p.newImage(current, name, from, value)
+	if index, err := strconv.Atoi(value); err == nil && index >= 0 && index < len(p.stages) {
+		image.Kind, image.Reference, image.Err = KindStage, nil, nil
+	}
+
+	p.file.Images = append(p.file.Images, image)
+}
+
+func (p *parser) newImage(current *instruction, name string, raw token, value string) Image {
+
+	offset := current.offsets[raw.start]
+	line, column := p.position(offset)
+
+	image := Image{
+		Instruction: name,
+		Raw:         raw.text,
+		Value:       value,
+		Offset:      offset,
+		End:         current.offsets[raw.start+len(raw.text)-1] + 1,
+		Line:        line,
+		Column:      column,
+	}
+
+	switch {
+	case strings.EqualFold(value, "scratch"):
+		image.Kind = KindScratch
+	case p.isStage(value):
+		image.Kind = KindStage
+	default:
+		image.Kind = KindImage
+		image.Reference, image.Err = dockerparser.Parse(value)
+	}
+
+	return image
+}
+
+func (p *parser) isStage(value string) bool {
+	for _, stage := range p.stages {
+		if stage != "" && strings.EqualFold(stage, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// declare handles an ARG instruction, in the global scope before the first FROM, or in the scope of
+// the current build stage.
+func (p *parser) declare(args []token) {
+	for _, arg := range args {
+		name, value, hasValue := arg.text, "", false
+		if i := strings.IndexByte(arg.text, '='); i != -1 {
+			name, value, hasValue = arg.text[:i], unquote(arg.text[i+1:]), true
+		}
+
+		if p.scope == nil {
+			if hasValue {
+				value, _ = p.expand(value, p.global)
+			}
+			if v, ok := p.args[name]; ok {
+				value = v
+			}
+			p.global[name] = value
+			continue
+		}
+
+		if hasValue {
+			value, _ = p.expand(value, p.scope)
+		} else if v, ok := p.global[name]; ok {
+			value = v
+		}
+		if v, ok := p.args[name]; ok {
+			value = v
+		}
+		p.scope[name] = value
+	}
+}
+
+// expand substitutes the variables in s with the ARG of the given scope.
+func (p *parser) expand(s string, scope map[string]string) (string, error) {
+	return expand(s, p.escape, func(name string) (string, bool) {
+		value, ok := scope[name]
+		return value, ok
+	})
+}
+
+// position returns the line and column of the given offset in the source.
+func (p *parser) position(offset int) (int, int) {
+	line := bytes.Count(p.source[:offset], []byte("\n")) + 1
+	column := offset - bytes.LastIndexByte(p.source[:offset], '\n')
+	return line, column
+}
+
+// mountFrom returns the "from" option of a RUN --mount flag.
+func mountFrom(flag token) (token, bool) {
+	options := flag.text[len("--mount="):]
+	start := flag.start + len("--mount=")
+	for _, option := range strings.Split(options, ",") {
+		if strings.HasPrefix(option, "from=") {
+			return token{text: option[len("from="):], start: start + len("from=")}, true
+		}
+		start += len(option) + 1
+	}
+	return token{}, false
+}
+
+func tokenize(s string) []token {
+	tokens := []token{}
+	for i := 0; i < len(s); {
+		if s[i] == ' ' || s[i] == '\t' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && s[j] != ' ' && s[j] != '\t' {
+			j++
+		}
+		tokens = append(tokens, token{text: s[i:j], start: i})
+		i = j
+	}
+	return tokens
+}
+
+// splitFlags splits the flags, such as --from=..., from the arguments of an instruction.
+func splitFlags(tokens []token) ([]token, []token) {
+	i := 0
+	for i < len(tokens) && strings.HasPrefix(tokens[i].text, "--") {
+		i++
+	}
+	return tokens[:i], tokens[i:]
+}
+
+func firstWord(s string) string {
+	s = strings.TrimLeft(s, " \t")
+	if i := strings.IndexAny(s, " \t"); i != -1 {
+		return s[:i]
+	}
+	return s
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,217 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dockerfile
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+
+	is := require.New(t)
+
+	file := parseFile(is, nil)
+
+	is.Len(file.Images, 8)
+
+	build := file.Images[0]
+	is.Equal("FROM", build.Instruction)
+	is.Equal(KindImage, build.Kind)
+	is.Equal("golang:${GO_VERSION}-alpine", build.Raw)
+	is.Equal("golang:1.14-alpine", build.Value)
+	is.Equal("$BUILDPLATFORM", build.Platform)
+	is.Equal("build", build.Stage)
+	is.Equal(6, build.Line)
+	is.Equal(32, build.Column)
+	is.Equal("docker.io/library/golang:1.14-alpine", build.Reference.Remote())
+
+	tools := file.Images[1]
+	is.Equal("RUN", tools.Instruction)
+	is.Equal(KindImage, tools.Kind)
+	is.Equal("ghcr.io/novln/tools:2", tools.Raw)
+	is.Equal(9, tools.Line)
+	is.Equal(28, tools.Column)
+
+	runtime := file.Images[2]
+	is.Equal("FROM", runtime.Instruction)
+	is.Equal("docker.io/library/alpine:3.12", runtime.Value)
+	is.Equal("runtime", runtime.Stage)
+	is.Equal(15, runtime.Line)
+
+	is.Equal(KindStage, file.Images[3].Kind)
+	is.Equal("build", file.Images[3].Value)
+	is.Equal(KindStage, file.Images[4].Kind)
+	is.Equal("0", file.Images[4].Value)
+	is.Equal(KindImage, file.Images[5].Kind)
+	is.Equal("docker.io/library/busybox:1.32", file.Images[5].Reference.Remote())
+	is.Equal(KindScratch, file.Images[6].Kind)
+	is.Equal(KindStage, file.Images[7].Kind)
+
+}
+
+func TestParseWithArgs(t *testing.T) {
+
+	is := require.New(t)
+
+	file := parseFile(is, map[string]string{
+		"GO_VERSION": "1.15",
+		"REGISTRY":   "localhost:5000",
+	})
+
+	is.Equal("golang:1.15-alpine", file.Images[0].Value)
+	is.Equal("localhost:5000/library/alpine:3.12", file.Images[2].Reference.Remote())
+
+}
+
+func TestParseError(t *testing.T) {
+
+	is := require.New(t)
+
+	file, err := Parse(strings.NewReader("FROM golang AS\n"), nil)
+	is.Error(err)
+	is.Nil(file)
+
+	file, err = Parse(strings.NewReader("FROM Golang\n"), nil)
+	is.NoError(err)
+	is.Len(file.Images, 1)
+	is.Error(file.Images[0].Err)
+	is.Nil(file.Images[0].Reference)
+
+	for _, source := range []string{"FROM a\nCOPY --from=\n", "FROM a\nRUN --mount=from=\n"} {
+		file, err = Parse(strings.NewReader(source), nil)
+		is.NoError(err, "parse error was not expected for %q", source)
+		is.Len(file.Images, 1)
+	}
+
+}
+
+func TestEscapeDirective(t *testing.T) {
+
+	is := require.New(t)
+
+	file, err := Parse(strings.NewReader("# escape=`\nARG TAG=ltsc2019\nFROM `\n  mcr.microsoft.com/windows/servercore:$TAG\n"), nil)
+	is.NoError(err)
+	is.Len(file.Images, 1)
+	is.Equal("mcr.microsoft.com/windows/servercore:ltsc2019", file.Images[0].Value)
+	is.Equal(4, file.Images[0].Line)
+	is.Equal(3, file.Images[0].Column)
+
+}
+
+func TestByteOrderMark(t *testing.T) {
+
+	is := require.New(t)
+
+	file, err := Parse(strings.NewReader("\xef\xbb\xbfFROM alpine:3.12\n"), nil)
+	is.NoError(err)
+	is.Len(file.Images, 1)
+	is.Equal("alpine:3.12", file.Images[0].Value)
+	is.Equal(8, file.Images[0].Offset)
+
+}
+
+func TestRewrite(t *testing.T) {
+
+	is := require.New(t)
+
+	file := parseFile(is, nil)
+
+	content := file.Rewrite(func(image Image) string {
+		if image.Reference == nil {
+			return image.Raw
+		}
+		return image.Reference.Repository() + "@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb"
+	})
+
+	expected := strings.NewReplacer(
+		"golang:${GO_VERSION}-alpine", "docker.io/library/golang@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb",
+		"ghcr.io/novln/tools:2", "ghcr.io/novln/tools@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb",
+		"${REGISTRY:-docker.io}/library/alpine:3.12", "docker.io/library/alpine@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb",
+		"busybox:1.32", "docker.io/library/busybox@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb",
+	).Replace(string(file.Bytes()))
+
+	is.Equal(expected, string(content))
+
+}
+
+func TestExpand(t *testing.T) {
+
+	is := require.New(t)
+
+	lookup := func(name string) (string, bool) {
+		value, ok := map[string]string{"A": "a", "EMPTY": ""}[name]
+		return value, ok
+	}
+
+	tests := map[string]string{
+		"$A-${A}":          "a-a",
+		"${EMPTY:-b}":      "b",
+		"${EMPTY-b}":       "",
+		"${UNSET-b}":       "b",
+		"${A:+b}":          "b",
+		"${UNSET:+b}":      "",
+		"${UNSET:-${A}/c}": "a/c",
+		`\$A`:              "$A",
+		"$":                "$",
+	}
+
+	for input, expected := range tests {
+		value, err := expand(input, '\\', lookup)
+		is.NoError(err)
+		is.Equal(expected, value, "unexpected expansion of %q", input)
+	}
+
+	_, err := expand("${A", '\\', lookup)
+	is.Error(err)
+
+}
+
+func parseFile(is *require.Assertions, args map[string]string) *File {
+
+	f, err := os.Open("testdata/Dockerfile")
+	is.NoError(err)
+	defer f.Close()
+
+	file, err := Parse(f, args)
+	is.NoError(err)
+	is.NotNil(file)
+
+	return file
+}
+
+func TestRewriteContinuation(t *testing.T) {
+
+	is := require.New(t)
+
+	file, err := Parse(strings.NewReader("FROM a\\\nlpine AS base\nCOPY --from=busy\\\nbox:1.32 / /\n"), nil)
+	is.NoError(err)
+	is.Len(file.Images, 2)
+	is.Equal("alpine", file.Images[0].Raw)
+	is.Equal(5, file.Images[0].Offset)
+	is.Equal(13, file.Images[0].End)
+
+	content := file.Rewrite(func(image Image) string {
+		return image.Reference.Repository() + ":latest"
+	})
+
+	is.Equal("FROM docker.io/library/alpine:latest AS base\nCOPY --from=docker.io/library/busybox:latest / /\n", string(content))
+
+}
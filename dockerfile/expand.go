@@ -0,0 +1,30 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dockerfile
+
+import (
+	"github.com/novln/docker-parser/internal/expansion"
+)
+
+// expand substitutes the variables in s, using the given escape character.
+// It supports $name, ${name}, ${name:-word}, ${name-word}, ${name:+word} and ${name+word}.
+// Undefined variables expand to an empty string.
+func expand(s string, escape byte, lookup func(name string) (string, bool)) (string, error) {
+	syntax := expansion.Dockerfile
+	syntax.Escape = escape
+	return syntax.Expand(s, lookup)
+}
@@ -0,0 +1,244 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dockerparser
+
+import (
+	"strings"
+)
+
+// DefaultMinConfidence is the confidence required by FindAll to report a match.
+const DefaultMinConfidence = 0.5
+
+// Match is an image reference found in a text.
+type Match struct {
+	// Start is the byte offset of the reference in the text.
+	Start int
+	// End is the byte offset right after the reference in the text.
+	End int
+	// Text is the reference as written in the text, ie: text[Start:End].
+	Text string
+	// Reference is the parsed reference.
+	Reference *Reference
+	// Confidence estimates, from 0 to 1, how likely the match is an image reference rather than a
+	// word, a path or an URL that happens to be a valid reference.
+	Confidence float64
+}
+
+// Finder locates image references in arbitrary text, such as logs, messages or Markdown documents.
+type Finder struct {
+	// MinConfidence is the confidence required to report a match.
+	MinConfidence float64
+}
+
+// FindAll returns the image references found in text, using DefaultMinConfidence.
+func FindAll(text string) []Match {
+	return Finder{MinConfidence: DefaultMinConfidence}.FindAll(text)
+}
+
+// FindAll returns the image references found in text whose confidence is at least MinConfidence,
+// in the order they appear.
+func (f Finder) FindAll(text string) []Match {
+
+	matches := []Match{}
+
+	for i := 0; i < len(text); {
+		if !isCandidate(text[i]) {
+			i++
+			continue
+		}
+
+		start, end := i, i
+		for end < len(text) && isCandidate(text[end]) {
+			end++
+		}
+		i = end
+
+		match, ok := newMatch(text, start, end)
+		if ok && match.Confidence >= f.MinConfidence {
+			matches = append(matches, match)
+		}
+	}
+
+	return matches
+}
+
+// newMatch analyzes the candidate text[start:end], which is delimited by characters that can't be
+// part of a reference, such as spaces, quotes or brackets.
+func newMatch(text string, start, end int) (Match, bool) {
+
+	candidate := text[start:end]
+
+	// Filesystem paths are never references, even if they contain one.
+	if strings.HasPrefix(candidate, "/") || strings.HasPrefix(candidate, "./") ||
+		strings.HasPrefix(candidate, "../") {
+		return Match{}, false
+	}
+
+	for start < end && !isLetter(text[start]) && !isDigit(text[start]) {
+		start++
+	}
+	for start < end && strings.IndexByte(".:-/@+", text[end-1]) != -1 {
+		end--
+	}
+	if start == end {
+		return Match{}, false
+	}
+
+	candidate = text[start:end]
+
+	// URLs are links to web pages, even if they designate a registry, such as
+	// "https://quay.io/repository/foo".
+	if candidate != clean(candidate) {
+		return Match{}, false
+	}
+
+	reference, err := Parse(candidate)
+	if err != nil {
+		return Match{}, false
+	}
+
+	return Match{
+		Start:      start,
+		End:        end,
+		Text:       candidate,
+		Reference:  reference,
+		Confidence: confidence(candidate),
+	}, true
+}
+
+// confidence estimates how likely the given candidate, which is a valid reference, was written as
+// an image reference. Explicit tags, digests and registries make it likely, whereas plain words,
+// file names and import paths make it unlikely.
+func confidence(candidate string) float64 {
+
+	name, tagged, digested := candidate, false, false
+	if i := strings.IndexByte(name, '@'); i != -1 {
+		name, digested = name[:i], true
+	}
+	if i := strings.LastIndexByte(name, ':'); i > strings.LastIndexByte(name, '/') {
+		name, tagged = name[:i], true
+	}
+
+	last := name[strings.LastIndexByte(name, '/')+1:]
+	if strings.IndexFunc(last, func(r rune) bool { return r >= 'a' && r <= 'z' }) == -1 {
+		// Versions, times and numbers, such as "10:30".
+		return 0
+	}
+
+	if !tagged && !digested && !strings.ContainsRune(name, '/') {
+		// Plain words.
+		return 0
+	}
+
+	score := 0.2
+
+	switch {
+	case digested:
+		score += 0.6
+	case tagged:
+		score += 0.3
+	}
+
+	if strings.ContainsRune(name, '/') {
+		score += 0.2
+	}
+
+	if i := strings.IndexByte(name, '/'); i != -1 {
+		hostname := name[:i]
+		switch {
+		case isWellKnownRegistry(hostname):
+			score += 0.5
+		case isWellKnownHost(hostname):
+			// Import paths and URLs without scheme, such as "github.com/novln/docker-parser".
+			score -= 0.5
+		case strings.ContainsRune(hostname, ':') || hostname == "localhost":
+			score += 0.3
+		case strings.ContainsRune(hostname, '.') && (tagged || digested):
+			score += 0.3
+		}
+	}
+
+	// Pairs of words, such as "key:value", unless the tag looks like a version.
+	if tagged && !digested && !strings.ContainsRune(name, '/') {
+		if tag := candidate[len(name)+1:]; tag != "latest" && !strings.ContainsAny(tag, "0123456789") {
+			score -= 0.3
+		}
+	}
+
+	// File names, such as "src/main.go".
+	if !tagged && !digested && strings.ContainsRune(last, '.') {
+		score -= 0.3
+	}
+
+	if score < 0 {
+		return 0
+	}
+	if score > 1 {
+		return 1
+	}
+	return score
+}
+
+// wellKnownRegistries are hostname suffixes of public registries.
+var wellKnownRegistries = []string{
+	"docker.io",
+	"ghcr.io",
+	"quay.io",
+	"gcr.io",
+	"pkg.dev",
+	"amazonaws.com",
+	"azurecr.io",
+	"mcr.microsoft.com",
+	"registry.k8s.io",
+}
+
+func isWellKnownRegistry(hostname string) bool {
+	return hasSuffix(hostname, wellKnownRegistries)
+}
+
+// wellKnownHosts are hostname suffixes of public services that aren't registries, but whose URLs
+// and import paths are valid references.
+var wellKnownHosts = []string{
+	"github.com",
+	"gitlab.com",
+	"bitbucket.org",
+	"golang.org",
+	"go.dev",
+	"gopkg.in",
+	"googlesource.com",
+	"k8s.io",
+}
+
+func isWellKnownHost(hostname string) bool {
+	return hasSuffix(hostname, wellKnownHosts)
+}
+
+// hasSuffix reports whether hostname is, or is a subdomain of, one of the given hostnames.
+func hasSuffix(hostname string, suffixes []string) bool {
+	hostname = strings.ToLower(hostname)
+	for _, suffix := range suffixes {
+		if hostname == suffix || strings.HasSuffix(hostname, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCandidate reports whether c may be part of a reference, including its scheme.
+func isCandidate(c byte) bool {
+	return isWord(c) || strings.IndexByte(".-/:@+", c) != -1
+}
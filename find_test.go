@@ -0,0 +1,97 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dockerparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindAll(t *testing.T) {
+
+	is := require.New(t)
+
+	text := "Step 1/7 : FROM golang:1.14-alpine AS build\n" +
+		"Pulling 'ghcr.io/novln/app@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb'...\n" +
+		"Deploy `localhost:5000/foo/bar:1.1`, then check https://github.com/novln/docker-parser.\n"
+
+	matches := FindAll(text)
+
+	is.Len(matches, 3)
+
+	is.Equal("golang:1.14-alpine", matches[0].Text)
+	is.Equal("docker.io/library/golang:1.14-alpine", matches[0].Reference.Remote())
+	is.Equal(matches[0].Text, text[matches[0].Start:matches[0].End])
+
+	is.Equal("ghcr.io/novln/app@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb", matches[1].Text)
+	is.Equal("ghcr.io", matches[1].Reference.Registry())
+	is.Equal(1.0, matches[1].Confidence)
+
+	is.Equal("localhost:5000/foo/bar:1.1", matches[2].Text)
+	is.Equal(matches[2].Text, text[matches[2].Start:matches[2].End])
+
+}
+
+func TestFindAllTrailingPunctuation(t *testing.T) {
+
+	is := require.New(t)
+
+	matches := FindAll("Please upgrade to nginx:1.25.")
+
+	is.Len(matches, 1)
+	is.Equal("nginx:1.25", matches[0].Text)
+	is.Equal(18, matches[0].Start)
+	is.Equal(28, matches[0].End)
+
+}
+
+func TestFindAllFalsePositives(t *testing.T) {
+
+	is := require.New(t)
+
+	texts := []string{
+		"nginx is running",
+		"meeting at 10:30 and/or later",
+		"see src/main.go or /usr/local/bin/docker",
+		"read https://github.com/novln/docker-parser",
+		"read https://example.com/foo:1.0?page=2",
+		"see https://quay.io/repository/foo",
+		"see https://ghcr.io/foo/bar",
+		"pull http://ghcr.io/foo/bar:1.0",
+		"mail john@example.com",
+		"go get github.com/novln/docker-parser",
+		"import golang.org/x/net and gopkg.in/yaml.v3",
+		"set key:value in the config",
+	}
+
+	for _, text := range texts {
+		is.Empty(FindAll(text), "no match was expected in %q", text)
+	}
+
+}
+
+func TestFinderMinConfidence(t *testing.T) {
+
+	is := require.New(t)
+
+	matches := Finder{MinConfidence: 0.3}.FindAll("see library/debian")
+
+	is.Len(matches, 1)
+	is.Equal("docker.io/library/debian:latest", matches[0].Reference.Remote())
+
+}
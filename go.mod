@@ -2,4 +2,8 @@ module github.com/novln/docker-parser
 
 go 1.14
 
-require github.com/stretchr/testify v1.5.1
+require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/stretchr/testify v1.5.1
+	gopkg.in/yaml.v3 v3.0.1
+)
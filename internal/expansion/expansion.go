@@ -0,0 +1,173 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package expansion substitutes shell-like variables, such as $VAR, ${VAR} and ${VAR:-default},
+// in the dialects of Dockerfiles and Compose files.
+package expansion
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Syntax is a dialect of variable substitution. Both dialects support $VAR, ${VAR},
+// ${VAR:-default}, ${VAR-default}, ${VAR:+replacement} and ${VAR+replacement}, where defaults and
+// replacements are substituted too.
+type Syntax struct {
+	// Escape is the character which, followed by a dollar sign, gives a literal dollar sign.
+	Escape byte
+	// Strict rejects dollar signs which don't start a variable and names starting with a digit,
+	// instead of keeping them as is.
+	Strict bool
+	// Required enables ${VAR:?error} and ${VAR?error}, which fail if the variable isn't set.
+	Required bool
+}
+
+var (
+	// Dockerfile is the syntax of Dockerfiles, whose escape character is a backslash by default.
+	Dockerfile = Syntax{Escape: '\\'}
+	// Compose is the syntax of Compose files, where $$ is a literal dollar sign.
+	Compose = Syntax{Escape: '$', Strict: true, Required: true}
+)
+
+// Expand substitutes the variables in s with the values returned by lookup. Undefined variables
+// expand to an empty string.
+func (syntax Syntax) Expand(s string, lookup func(name string) (string, bool)) (string, error) {
+
+	b := strings.Builder{}
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if c == syntax.Escape && i+1 < len(s) && s[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+
+		if c != '$' || i+1 == len(s) {
+			b.WriteByte(c)
+			continue
+		}
+
+		if s[i+1] == '{' {
+			end := closingBrace(s, i+2)
+			if end == -1 {
+				return "", fmt.Errorf("invalid interpolation format for %q: missing '}'", s)
+			}
+			value, err := syntax.substitute(s[i+2:end], lookup)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(value)
+			i = end
+			continue
+		}
+
+		if syntax.Strict && !isNameStart(s[i+1]) {
+			return "", fmt.Errorf("invalid interpolation format for %q", s)
+		}
+
+		j := i + 1
+		for j < len(s) && isNameChar(s[j]) {
+			j++
+		}
+		if j == i+1 {
+			b.WriteByte(c)
+			continue
+		}
+		value, _ := lookup(s[i+1 : j])
+		b.WriteString(value)
+		i = j - 1
+	}
+
+	return b.String(), nil
+}
+
+// substitute returns the value of the content of a ${...} expression.
+func (syntax Syntax) substitute(s string, lookup func(name string) (string, bool)) (string, error) {
+
+	j := 0
+	for j < len(s) && isNameChar(s[j]) {
+		j++
+	}
+	if j == 0 || (syntax.Strict && !isNameStart(s[0])) {
+		return "", fmt.Errorf("invalid interpolation format for ${%s}", s)
+	}
+
+	name, modifier := s[:j], s[j:]
+	value, defined := lookup(name)
+
+	colon := strings.HasPrefix(modifier, ":")
+	if colon {
+		modifier = modifier[1:]
+	}
+	// With a colon, an empty variable is handled as an unset one.
+	set := defined && (!colon || value != "")
+
+	switch {
+	case modifier == "" && !colon:
+		return value, nil
+	case strings.HasPrefix(modifier, "-"):
+		if set {
+			return value, nil
+		}
+		return syntax.Expand(modifier[1:], lookup)
+	case strings.HasPrefix(modifier, "+"):
+		if set {
+			return syntax.Expand(modifier[1:], lookup)
+		}
+		return "", nil
+	case strings.HasPrefix(modifier, "?") && syntax.Required:
+		if set {
+			return value, nil
+		}
+		message, err := syntax.Expand(modifier[1:], lookup)
+		if err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("required variable %s is missing a value: %s", name, message)
+	default:
+		return "", fmt.Errorf("invalid interpolation format for ${%s}", s)
+	}
+}
+
+// closingBrace returns the index of the brace closing a ${...} expression whose content starts
+// at the given index, or -1 if there is none.
+func closingBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
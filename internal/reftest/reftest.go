@@ -0,0 +1,34 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package reftest provides the fixtures shared by the tests of the packages handling references.
+package reftest
+
+import (
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/stretchr/testify/require"
+)
+
+// Parse returns the reference of the given remote identifier, and stops the test if it's invalid.
+func Parse(t require.TestingT, remote string) *dockerparser.Reference {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+
+	ref, err := dockerparser.Parse(remote)
+	require.NoError(t, err)
+	return ref
+}
@@ -0,0 +1,36 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package suffix gives the tag or digest of references in the form appended to their repository,
+// so that references can be rebuilt in another repository.
+package suffix
+
+import (
+	dockerparser "github.com/novln/docker-parser"
+)
+
+// Of returns the tag or digest of the reference, with its separator, or an empty string if its tag
+// is implicit, so that it stays implicit. (ie: ":1.25", "@sha256:..." or "")
+func Of(ref *dockerparser.Reference) string {
+	switch {
+	case ref.HasImplicitTag():
+		return ""
+	case ref.HasDigest():
+		return "@" + ref.Tag()
+	default:
+		return ":" + ref.Tag()
+	}
+}
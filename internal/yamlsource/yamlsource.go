@@ -0,0 +1,219 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package yamlsource locates YAML scalars in their source, so that they can be rewritten without
+// reformatting the rest of the document.
+package yamlsource
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scalar is the location of a single line scalar in its source.
+type Scalar struct {
+	// Start and End delimit the scalar in the source, including its quotes.
+	Start int
+	End   int
+	// Line is the line number of the scalar, starting at 1.
+	Line int
+	// Column is the column of the scalar in its line, starting at 1.
+	Column int
+	// Style is the quoting style of the scalar.
+	Style yaml.Style
+}
+
+// Source is a YAML source, which may contain multiple documents.
+type Source struct {
+	data  []byte
+	lines []int
+}
+
+// New returns a Source for the given data.
+func New(data []byte) *Source {
+	lines := []int{0}
+	for i, c := range data {
+		if c == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return &Source{data: data, lines: lines}
+}
+
+// Locate returns the location of a scalar node decoded from the source. It returns false if the
+// scalar doesn't fit on a single line, such as block scalars.
+func (s *Source) Locate(node *yaml.Node) (Scalar, bool) {
+
+	if node.Kind != yaml.ScalarNode || node.Line < 1 || node.Line > len(s.lines) {
+		return Scalar{}, false
+	}
+
+	data := s.data
+	begin := s.lines[node.Line-1]
+	start := begin
+	for column := 1; column < node.Column && start < len(data); column++ {
+		_, size := utf8.DecodeRune(data[start:])
+		start += size
+	}
+
+	// Skip the anchor and the tag of the node, if any.
+	for start < len(data) && (data[start] == '&' || data[start] == '!') {
+		for start < len(data) && data[start] != ' ' && data[start] != '\t' && data[start] != '\n' {
+			start++
+		}
+		for start < len(data) && (data[start] == ' ' || data[start] == '\t') {
+			start++
+		}
+	}
+
+	eol := bytes.IndexByte(data[start:], '\n')
+	if eol == -1 {
+		eol = len(data)
+	} else {
+		eol += start
+	}
+	line := string(data[start:eol])
+
+	end := -1
+
+	switch node.Style {
+	case yaml.DoubleQuotedStyle:
+		for i := 1; i < len(line) && end == -1; i++ {
+			switch line[i] {
+			case '\\':
+				i++
+			case '"':
+				end = start + i + 1
+			}
+		}
+	case yaml.SingleQuotedStyle:
+		for i := 1; i < len(line) && end == -1; i++ {
+			if line[i] == '\'' {
+				if i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					continue
+				}
+				end = start + i + 1
+			}
+		}
+	case 0:
+		if i := strings.Index(line, " #"); i != -1 {
+			line = line[:i]
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if line == node.Value {
+			end = start + len(line)
+		}
+	}
+
+	if end == -1 {
+		return Scalar{}, false
+	}
+
+	return Scalar{
+		Start:  start,
+		End:    end,
+		Line:   node.Line,
+		Column: utf8.RuneCount(data[begin:start]) + 1,
+		Style:  node.Style,
+	}, true
+}
+
+// Quote formats value as a scalar of the given style.
+func Quote(value string, style yaml.Style) string {
+	switch style {
+	case yaml.DoubleQuotedStyle:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+	case yaml.SingleQuotedStyle:
+		return `'` + strings.Replace(value, `'`, `''`, -1) + `'`
+	default:
+		return value
+	}
+}
+
+// Edit replaces a scalar by a new value, using the scalar's quoting style.
+type Edit struct {
+	Scalar Scalar
+	Value  string
+}
+
+// Apply returns a copy of data with the given edits applied. When edits overlap, such as for a
+// scalar shared with an alias, only the first one is applied.
+func Apply(data []byte, edits []Edit) []byte {
+
+	sorted := make([]Edit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Scalar.Start < sorted[j].Scalar.Start
+	})
+
+	b := bytes.Buffer{}
+	last := 0
+
+	for _, edit := range sorted {
+		if edit.Scalar.Start < last {
+			continue
+		}
+		b.Write(data[last:edit.Scalar.Start])
+		b.WriteString(Quote(edit.Value, edit.Scalar.Style))
+		last = edit.Scalar.End
+	}
+	b.Write(data[last:])
+
+	return b.Bytes()
+}
+
+// Resolve follows aliases to the node they refer to.
+func Resolve(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// Lookup returns the value associated to key in a mapping node, or nil.
+// Mappings merged with the "<<" key are also looked up.
+func Lookup(node *yaml.Node, key string) *yaml.Node {
+	node = Resolve(node)
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key && node.Content[i].Tag != "!!merge" {
+			return Resolve(node.Content[i+1])
+		}
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Tag != "!!merge" {
+			continue
+		}
+		merged := Resolve(node.Content[i+1])
+		sources := []*yaml.Node{merged}
+		if merged.Kind == yaml.SequenceNode {
+			sources = merged.Content
+		}
+		for _, source := range sources {
+			if value := Lookup(source, key); value != nil {
+				return value
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package kubernetes finds and rewrites the container images of Kubernetes manifests.
+//
+// It walks the pod specification of Pod, PodTemplate, Deployment, ReplicaSet, ReplicationController,
+// StatefulSet, DaemonSet, Job and CronJob objects, including those wrapped in a List, across every
+// document of a YAML stream.
+package kubernetes
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/internal/yamlsource"
+)
+
+// Image is the image of a container found in a Kubernetes manifest.
+type Image struct {
+	// Document is the index of the YAML document declaring the object, starting at 0.
+	Document int
+	// Kind is the kind of the object, such as Deployment.
+	Kind string
+	// Name is the name of the object.
+	Name string
+	// Namespace is the namespace of the object, if any.
+	Namespace string
+	// Container is the name of the container.
+	Container string
+	// Path is the path of the image in the document, such as spec.template.spec.containers[0].image.
+	Path string
+	// Raw is the reference as written in the manifest.
+	Raw string
+	// Line is the line number of the reference, starting at 1.
+	Line int
+	// Column is the column of the reference in its line, starting at 1.
+	Column int
+	// Reference is the parsed reference, if Raw is valid.
+	Reference *dockerparser.Reference
+	// Err is the reason why Raw couldn't be parsed.
+	Err error
+
+	scalar  yamlsource.Scalar
+	located bool
+}
+
+// File is a parsed Kubernetes manifest, which may contain multiple documents.
+type File struct {
+	// Images lists the container images in the order they appear.
+	Images []Image
+	source []byte
+}
+
+// podSpecs lists, by kind, the path to the pod specification of an object.
+var podSpecs = map[string][]string{
+	"Pod":                   {"spec"},
+	"PodTemplate":           {"template", "spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// containerFields lists the fields of a pod specification holding containers.
+var containerFields = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// Parse reads a Kubernetes manifest from r and returns its container images.
+func Parse(r io.Reader) (*File, error) {
+
+	source, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{source: source}
+	walker := &walker{
+		source: yamlsource.New(source),
+		file:   file,
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(source))
+
+	for document := 0; ; document++ {
+		node := yaml.Node{}
+		err = decoder.Decode(&node)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(node.Content) == 1 {
+			walker.walkObject(document, "", node.Content[0])
+		}
+	}
+
+	return file, nil
+}
+
+// Bytes returns the content of the manifest.
+func (f *File) Bytes() []byte {
+	return f.source
+}
+
+// Rewrite returns the content of the manifest with images replaced by the result of fn, such as a
+// relocated or pinned reference, leaving everything else untouched. It should return the image's Raw
+// value to keep it unchanged. The quoting style of each reference is preserved, and images that don't
+// fit on a single line, such as block scalars, are left untouched.
+func (f *File) Rewrite(fn func(image Image) string) []byte {
+
+	edits := []yamlsource.Edit{}
+
+	for _, image := range f.Images {
+		if !image.located {
+			continue
+		}
+		if value := fn(image); value != image.Raw {
+			edits = append(edits, yamlsource.Edit{Scalar: image.scalar, Value: value})
+		}
+	}
+
+	return yamlsource.Apply(f.source, edits)
+}
+
+type walker struct {
+	source *yamlsource.Source
+	file   *File
+}
+
+// walkObject adds the images of the given object, whose path in the document is prefix.
+func (w *walker) walkObject(document int, prefix string, object *yaml.Node) {
+
+	kind := scalar(yamlsource.Lookup(object, "kind"))
+
+	if strings.HasSuffix(kind, "List") {
+		items := yamlsource.Lookup(object, "items")
+		if items != nil && items.Kind == yaml.SequenceNode {
+			for i, item := range items.Content {
+				w.walkObject(document, prefix+"items["+strconv.Itoa(i)+"].", yamlsource.Resolve(item))
+			}
+		}
+		return
+	}
+
+	fields, ok := podSpecs[kind]
+	if !ok {
+		return
+	}
+
+	spec := object
+	for _, field := range fields {
+		spec = yamlsource.Lookup(spec, field)
+		if spec == nil {
+			return
+		}
+	}
+	prefix += strings.Join(fields, ".") + "."
+
+	metadata := yamlsource.Lookup(object, "metadata")
+	name, namespace := "", ""
+	if metadata != nil {
+		name = scalar(yamlsource.Lookup(metadata, "name"))
+		namespace = scalar(yamlsource.Lookup(metadata, "namespace"))
+	}
+
+	for _, field := range containerFields {
+		containers := yamlsource.Lookup(spec, field)
+		if containers == nil || containers.Kind != yaml.SequenceNode {
+			continue
+		}
+
+		for i, container := range containers.Content {
+			node := yamlsource.Lookup(container, "image")
+			if node == nil || node.Kind != yaml.ScalarNode {
+				continue
+			}
+
+			image := Image{
+				Document:  document,
+				Kind:      kind,
+				Name:      name,
+				Namespace: namespace,
+				Container: scalar(yamlsource.Lookup(container, "name")),
+				Path:      prefix + field + "[" + strconv.Itoa(i) + "].image",
+				Raw:       node.Value,
+				Line:      node.Line,
+				Column:    node.Column,
+			}
+
+			image.scalar, image.located = w.source.Locate(node)
+			if image.located {
+				image.Column = image.scalar.Column
+			}
+
+			image.Reference, image.Err = dockerparser.Parse(node.Value)
+
+			w.file.Images = append(w.file.Images, image)
+		}
+	}
+}
+
+// scalar returns the value of a scalar node, or an empty string.
+func scalar(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
@@ -0,0 +1,116 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+
+	is := require.New(t)
+
+	file := parseFile(is, "testdata/manifests.yaml")
+
+	is.Len(file.Images, 6)
+
+	migrate := file.Images[0]
+	is.Equal(0, migrate.Document)
+	is.Equal("Deployment", migrate.Kind)
+	is.Equal("api", migrate.Name)
+	is.Equal("prod", migrate.Namespace)
+	is.Equal("migrate", migrate.Container)
+	is.Equal("spec.template.spec.initContainers[0].image", migrate.Path)
+	is.Equal(12, migrate.Line)
+	is.Equal(18, migrate.Column)
+	is.Equal("ghcr.io/novln/migrate:1.2", migrate.Reference.Remote())
+
+	proxy := file.Images[2]
+	is.Equal("spec.template.spec.containers[1].image", proxy.Path)
+	is.Equal("docker.io/envoyproxy/envoy:v1.16.0", proxy.Reference.Remote())
+
+	backup := file.Images[3]
+	is.Equal(2, backup.Document)
+	is.Equal("CronJob", backup.Kind)
+	is.Equal("spec.jobTemplate.spec.template.spec.containers[0].image", backup.Path)
+	is.Equal(39, backup.Line)
+
+	shell := file.Images[4]
+	is.Equal(3, shell.Document)
+	is.Equal("Pod", shell.Kind)
+	is.Equal("debug", shell.Name)
+	is.Equal("items[0].spec.containers[0].image", shell.Path)
+	is.Equal("docker.io/library/busybox:latest", shell.Reference.Remote())
+
+	debugger := file.Images[5]
+	is.Equal("items[0].spec.ephemeralContainers[0].image", debugger.Path)
+	is.Error(debugger.Err)
+	is.Nil(debugger.Reference)
+
+}
+
+func TestParseError(t *testing.T) {
+
+	is := require.New(t)
+
+	file, err := Parse(strings.NewReader("kind: Pod\nspec: [\n"))
+	is.Error(err)
+	is.Nil(file)
+
+}
+
+func TestRewrite(t *testing.T) {
+
+	is := require.New(t)
+
+	file := parseFile(is, "testdata/manifests.yaml")
+
+	content := file.Rewrite(func(image Image) string {
+		if image.Reference == nil {
+			return image.Raw
+		}
+		registry := map[string]string{
+			"docker.io":      "dockerhub",
+			"ghcr.io":        "ghcr",
+			"localhost:5000": "local",
+		}[image.Reference.Registry()]
+		return "harbor.corp/" + registry + "/" + image.Reference.Name()
+	})
+
+	expected, err := ioutil.ReadFile("testdata/manifests.relocated.yaml")
+	is.NoError(err)
+	is.Equal(string(expected), string(content))
+
+}
+
+func parseFile(is *require.Assertions, path string) *File {
+
+	f, err := os.Open(path)
+	is.NoError(err)
+	defer f.Close()
+
+	file, err := Parse(f)
+	is.NoError(err)
+	is.NotNil(file)
+
+	return file
+}
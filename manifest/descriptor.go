@@ -0,0 +1,141 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/novln/docker-parser/distribution/digest"
+)
+
+// mediaTypeRegexp matches media types as defined by RFC 6838.
+var mediaTypeRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9!#$&^_.+-]{0,126}/[A-Za-z0-9][A-Za-z0-9!#$&^_.+-]{0,126}$`)
+
+// Descriptor describes the content a manifest or an index points to.
+type Descriptor struct {
+	// MediaType is the media type of the content.
+	MediaType string `json:"mediaType"`
+	// Digest is the digest of the content.
+	Digest digest.Digest `json:"digest"`
+	// Size is the size of the content in bytes.
+	Size int64 `json:"size"`
+	// URLs are the locations the content can be downloaded from, for foreign layers.
+	URLs []string `json:"urls,omitempty"`
+	// Annotations are arbitrary metadata.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Data is the content itself, embedded in the descriptor.
+	Data []byte `json:"data,omitempty"`
+	// Platform is the platform of the manifest a descriptor of an index points to.
+	Platform *Platform `json:"platform,omitempty"`
+	// ArtifactType is the type of the artifact a descriptor of an index points to.
+	ArtifactType string `json:"artifactType,omitempty"`
+}
+
+// Platform is the platform an image runs on.
+type Platform struct {
+	// Architecture is the CPU architecture, using the values of GOARCH. (ie: amd64, arm64)
+	Architecture string `json:"architecture"`
+	// OS is the operating system, using the values of GOOS. (ie: linux, windows)
+	OS string `json:"os"`
+	// OSVersion is the version of the operating system. (ie: 10.0.17763.1040)
+	OSVersion string `json:"os.version,omitempty"`
+	// OSFeatures are the features required from the operating system. (ie: win32k)
+	OSFeatures []string `json:"os.features,omitempty"`
+	// Variant is the variant of the CPU. (ie: v7 for arm)
+	Variant string `json:"variant,omitempty"`
+	// Features are the features required from the CPU, reserved for future use.
+	Features []string `json:"features,omitempty"`
+}
+
+// DescriptorOf returns the descriptor of the given content, with its size and canonical digest.
+func DescriptorOf(mediaType string, content []byte) Descriptor {
+	return Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(content),
+		Size:      int64(len(content)),
+	}
+}
+
+// Validate checks the media type, the digest and the size of the descriptor, and the embedded data
+// and platform, if any.
+func (d *Descriptor) Validate() error {
+
+	if !mediaTypeRegexp.MatchString(d.MediaType) {
+		return fmt.Errorf("invalid media type %q", d.MediaType)
+	}
+
+	if err := d.Digest.Validate(); err != nil {
+		return fmt.Errorf("invalid digest %q: %s", d.Digest, err)
+	}
+
+	if d.Size < 0 {
+		return fmt.Errorf("invalid size %d of %s", d.Size, d.Digest)
+	}
+
+	if d.Data != nil {
+		if err := d.Verify(d.Data); err != nil {
+			return fmt.Errorf("invalid data: %s", err)
+		}
+	}
+
+	if d.Platform != nil && (d.Platform.OS == "" || d.Platform.Architecture == "") {
+		return fmt.Errorf("invalid platform of %s: os and architecture are required", d.Digest)
+	}
+
+	if d.ArtifactType != "" && !mediaTypeRegexp.MatchString(d.ArtifactType) {
+		return fmt.Errorf("invalid artifact type %q", d.ArtifactType)
+	}
+
+	return nil
+}
+
+// Verify checks that the content has the size and the digest of the descriptor.
+func (d *Descriptor) Verify(content []byte) error {
+
+	if int64(len(content)) != d.Size {
+		return fmt.Errorf("content of %s has %d bytes instead of %d", d.Digest, len(content), d.Size)
+	}
+
+	if err := d.Digest.Validate(); err != nil {
+		return fmt.Errorf("invalid digest %q: %s", d.Digest, err)
+	}
+	if !d.Digest.Algorithm().Available() {
+		return fmt.Errorf("invalid digest %q: %s", d.Digest, digest.ErrDigestUnsupported)
+	}
+	if actual := d.Digest.Algorithm().FromBytes(content); actual != d.Digest {
+		return fmt.Errorf("content of %s has digest %s", d.Digest, actual)
+	}
+
+	return nil
+}
+
+// validateDescriptors checks the descriptors of a manifest or an index.
+func validateDescriptors(field string, descriptors []Descriptor) error {
+
+	for i := range descriptors {
+		if err := descriptors[i].Validate(); err != nil {
+			return fmt.Errorf("%s[%d]: %s", field, i, err)
+		}
+	}
+
+	return nil
+}
+
+// errSchemaVersion is returned for manifests and indexes whose schema version isn't 2.
+var errSchemaVersion = errors.New("schemaVersion must be 2")
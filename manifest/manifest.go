@@ -0,0 +1,335 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package manifest defines the OCI image manifest and index, and the Docker v2 schema2 manifest
+// and manifest list, with their descriptors. Payloads are strictly validated when parsed, and
+// their descriptors, with digests, can be computed from their canonical bytes.
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Media types of manifests and indexes.
+const (
+	MediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	MediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeDockerSchema1  = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+)
+
+// Media types of configs and layers.
+const (
+	MediaTypeOCIConfig          = "application/vnd.oci.image.config.v1+json"
+	MediaTypeOCIEmpty           = "application/vnd.oci.empty.v1+json"
+	MediaTypeOCILayer           = "application/vnd.oci.image.layer.v1.tar"
+	MediaTypeOCILayerGzip       = "application/vnd.oci.image.layer.v1.tar+gzip"
+	MediaTypeOCILayerZstd       = "application/vnd.oci.image.layer.v1.tar+zstd"
+	MediaTypeDockerConfig       = "application/vnd.docker.container.image.v1+json"
+	MediaTypeDockerLayer        = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+	MediaTypeDockerForeignLayer = "application/vnd.docker.image.rootfs.foreign.diff.tar.gzip"
+)
+
+// Payload is a manifest or an index.
+type Payload interface {
+	// Type returns the media type of the payload.
+	Type() string
+	// Descriptors returns the descriptors the payload points to: the config and the layers of a
+	// manifest, or the manifests of an index.
+	Descriptors() []Descriptor
+	// Validate checks the payload against its specification.
+	Validate() error
+}
+
+// Manifest is an OCI image manifest.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Index is an OCI image index.
+type Index struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Manifests     []Descriptor      `json:"manifests"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// DockerManifest is a Docker v2 schema2 image manifest.
+type DockerManifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// DockerList is a Docker v2 schema2 manifest list.
+type DockerList struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// Type returns MediaTypeOCIManifest.
+func (m *Manifest) Type() string {
+	return MediaTypeOCIManifest
+}
+
+// Descriptors returns the config and the layers of the manifest.
+func (m *Manifest) Descriptors() []Descriptor {
+	return append([]Descriptor{m.Config}, m.Layers...)
+}
+
+// Validate checks the manifest against the OCI image specification.
+func (m *Manifest) Validate() error {
+
+	if m.SchemaVersion != 2 {
+		return errSchemaVersion
+	}
+	if m.MediaType != "" && m.MediaType != MediaTypeOCIManifest {
+		return fmt.Errorf("unexpected media type %q", m.MediaType)
+	}
+	if m.ArtifactType != "" && !mediaTypeRegexp.MatchString(m.ArtifactType) {
+		return fmt.Errorf("invalid artifact type %q", m.ArtifactType)
+	}
+	if m.Config.MediaType == MediaTypeOCIEmpty && m.ArtifactType == "" {
+		return fmt.Errorf("artifactType is required with an empty config")
+	}
+
+	if err := m.Config.Validate(); err != nil {
+		return fmt.Errorf("config: %s", err)
+	}
+	if m.Layers == nil {
+		return fmt.Errorf("layers are required")
+	}
+	if err := validateDescriptors("layers", m.Layers); err != nil {
+		return err
+	}
+
+	return validateSubject(m.Subject)
+}
+
+// Type returns MediaTypeOCIIndex.
+func (i *Index) Type() string {
+	return MediaTypeOCIIndex
+}
+
+// Descriptors returns the manifests of the index.
+func (i *Index) Descriptors() []Descriptor {
+	return i.Manifests
+}
+
+// Validate checks the index against the OCI image specification.
+func (i *Index) Validate() error {
+
+	if i.SchemaVersion != 2 {
+		return errSchemaVersion
+	}
+	if i.MediaType != "" && i.MediaType != MediaTypeOCIIndex {
+		return fmt.Errorf("unexpected media type %q", i.MediaType)
+	}
+	if i.ArtifactType != "" && !mediaTypeRegexp.MatchString(i.ArtifactType) {
+		return fmt.Errorf("invalid artifact type %q", i.ArtifactType)
+	}
+
+	if i.Manifests == nil {
+		return fmt.Errorf("manifests are required")
+	}
+	if err := validateDescriptors("manifests", i.Manifests); err != nil {
+		return err
+	}
+
+	return validateSubject(i.Subject)
+}
+
+// Type returns MediaTypeDockerManifest.
+func (m *DockerManifest) Type() string {
+	return MediaTypeDockerManifest
+}
+
+// Descriptors returns the config and the layers of the manifest.
+func (m *DockerManifest) Descriptors() []Descriptor {
+	return append([]Descriptor{m.Config}, m.Layers...)
+}
+
+// Validate checks the manifest against the Docker v2 schema2 specification.
+func (m *DockerManifest) Validate() error {
+
+	if m.SchemaVersion != 2 {
+		return errSchemaVersion
+	}
+	if m.MediaType != MediaTypeDockerManifest {
+		return fmt.Errorf("unexpected media type %q", m.MediaType)
+	}
+
+	if err := m.Config.Validate(); err != nil {
+		return fmt.Errorf("config: %s", err)
+	}
+	if m.Layers == nil {
+		return fmt.Errorf("layers are required")
+	}
+
+	return validateDescriptors("layers", m.Layers)
+}
+
+// Type returns MediaTypeDockerList.
+func (l *DockerList) Type() string {
+	return MediaTypeDockerList
+}
+
+// Descriptors returns the manifests of the list.
+func (l *DockerList) Descriptors() []Descriptor {
+	return l.Manifests
+}
+
+// Validate checks the manifest list against the Docker v2 schema2 specification, which requires
+// a platform for every manifest.
+func (l *DockerList) Validate() error {
+
+	if l.SchemaVersion != 2 {
+		return errSchemaVersion
+	}
+	if l.MediaType != MediaTypeDockerList {
+		return fmt.Errorf("unexpected media type %q", l.MediaType)
+	}
+
+	if l.Manifests == nil {
+		return fmt.Errorf("manifests are required")
+	}
+	for i := range l.Manifests {
+		if l.Manifests[i].Platform == nil {
+			return fmt.Errorf("manifests[%d]: platform is required", i)
+		}
+	}
+
+	return validateDescriptors("manifests", l.Manifests)
+}
+
+func validateSubject(subject *Descriptor) error {
+	if subject == nil {
+		return nil
+	}
+	if err := subject.Validate(); err != nil {
+		return fmt.Errorf("subject: %s", err)
+	}
+	return nil
+}
+
+// Parse reads a manifest or an index with the given media type, such as the Content-Type returned
+// by a registry. If the media type is empty, the mediaType field of the payload is used, and OCI
+// payloads without mediaType are told apart by their fields.
+//
+// Payloads are strictly read: mismatching media types, fields of the other kind of payload (ie:
+// manifests in an image manifest) and invalid descriptors are rejected.
+func Parse(mediaType string, body []byte) (Payload, error) {
+
+	probe := struct {
+		MediaType string          `json:"mediaType"`
+		Config    json.RawMessage `json:"config"`
+		Layers    json.RawMessage `json:"layers"`
+		Manifests json.RawMessage `json:"manifests"`
+	}{}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %s", err)
+	}
+
+	switch {
+	case mediaType == "":
+		mediaType = probe.MediaType
+	case probe.MediaType != "" && probe.MediaType != mediaType:
+		return nil, fmt.Errorf("invalid manifest: media type %q instead of %q", probe.MediaType, mediaType)
+	}
+	if mediaType == "" && probe.Manifests != nil {
+		mediaType = MediaTypeOCIIndex
+	}
+	if mediaType == "" && probe.Config != nil {
+		mediaType = MediaTypeOCIManifest
+	}
+
+	var payload Payload
+	switch mediaType {
+	case MediaTypeOCIManifest:
+		payload = &Manifest{}
+	case MediaTypeOCIIndex:
+		payload = &Index{}
+	case MediaTypeDockerManifest:
+		payload = &DockerManifest{}
+	case MediaTypeDockerList:
+		payload = &DockerList{}
+	default:
+		return nil, fmt.Errorf("unsupported manifest media type %q", mediaType)
+	}
+
+	switch payload.(type) {
+	case *Manifest, *DockerManifest:
+		if probe.Manifests != nil {
+			return nil, fmt.Errorf("invalid %s: unexpected manifests", mediaType)
+		}
+	case *Index, *DockerList:
+		if probe.Config != nil || probe.Layers != nil {
+			return nil, fmt.Errorf("invalid %s: unexpected config or layers", mediaType)
+		}
+	}
+
+	if err := json.Unmarshal(body, payload); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", mediaType, err)
+	}
+
+	if err := payload.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", mediaType, err)
+	}
+
+	return payload, nil
+}
+
+// Marshal validates the payload and returns its canonical bytes.
+//
+// The canonical bytes of a parsed payload might differ from the parsed bytes, and so might its
+// digest: use DescriptorOf with the parsed bytes to describe a payload returned by a registry.
+func Marshal(payload Payload) ([]byte, error) {
+
+	if err := payload.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", payload.Type(), err)
+	}
+
+	return json.Marshal(payload)
+}
+
+// Describe returns the descriptor of the canonical bytes of the payload, with its digest, in order
+// to reference it from an index or to push it.
+func Describe(payload Payload) (Descriptor, error) {
+
+	body, err := Marshal(payload)
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	descriptor := DescriptorOf(payload.Type(), body)
+	if m, ok := payload.(*Manifest); ok {
+		descriptor.ArtifactType = m.ArtifactType
+	}
+
+	return descriptor, nil
+}
@@ -0,0 +1,206 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package manifest
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/novln/docker-parser/distribution/digest"
+	"github.com/stretchr/testify/require"
+)
+
+const testDigest = "sha256:b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7"
+
+func read(is *require.Assertions, name string) []byte {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	is.NoError(err)
+	return body
+}
+
+func TestParse(t *testing.T) {
+
+	is := require.New(t)
+
+	tests := map[string]string{
+		"oci-manifest.json":    MediaTypeOCIManifest,
+		"oci-index.json":       MediaTypeOCIIndex,
+		"docker-manifest.json": MediaTypeDockerManifest,
+		"docker-list.json":     MediaTypeDockerList,
+	}
+
+	for name, mediaType := range tests {
+		body := read(is, name)
+
+		payload, err := Parse("", body)
+		is.NoError(err, "parse error was not expected for %s", name)
+		is.Equal(mediaType, payload.Type())
+
+		payload, err = Parse(mediaType, body)
+		is.NoError(err, "parse error was not expected for %s", name)
+		is.Equal(mediaType, payload.Type())
+	}
+
+	payload, err := Parse("", read(is, "oci-manifest.json"))
+	is.NoError(err)
+	m := payload.(*Manifest)
+	is.Len(m.Layers, 2)
+	is.Equal(digest.Digest(testDigest), m.Config.Digest)
+	is.Equal(int64(7023), m.Config.Size)
+	is.Len(payload.Descriptors(), 3)
+
+	payload, err = Parse(MediaTypeOCIIndex, read(is, "oci-index.json"))
+	is.NoError(err)
+	index := payload.(*Index)
+	is.Equal("v8", index.Manifests[1].Platform.Variant)
+
+	payload, err = Parse("", read(is, "docker-list.json"))
+	is.NoError(err)
+	list := payload.(*DockerList)
+	is.Equal("10.0.17763.1040", list.Manifests[1].Platform.OSVersion)
+	is.Equal([]string{"win32k"}, list.Manifests[1].Platform.OSFeatures)
+
+	payload, err = Parse("", read(is, "docker-manifest.json"))
+	is.NoError(err)
+	is.Len(payload.(*DockerManifest).Layers[1].URLs, 1)
+
+}
+
+func TestParseInvalid(t *testing.T) {
+
+	is := require.New(t)
+
+	descriptor := `{"mediaType": "application/vnd.oci.image.config.v1+json", "digest": "` + testDigest + `", "size": 7023}`
+
+	invalid := map[string]string{
+		"not json":  `{"schemaVersion": 2,`,
+		"trailing":  `{"schemaVersion": 2, "config": ` + descriptor + `, "layers": []} {}`,
+		"unknown":   `{"schemaVersion": 2}`,
+		"version":   `{"schemaVersion": 1, "config": ` + descriptor + `, "layers": []}`,
+		"layers":    `{"schemaVersion": 2, "config": ` + descriptor + `}`,
+		"ambiguous": `{"schemaVersion": 2, "config": ` + descriptor + `, "layers": [], "manifests": []}`,
+		"index":     `{"schemaVersion": 2, "mediaType": "` + MediaTypeOCIIndex + `", "manifests": [], "layers": []}`,
+		"digest": `{"schemaVersion": 2, "config": {"mediaType": "application/vnd.oci.image.config.v1+json",` +
+			`"digest": "sha256:b5b2", "size": 7023}, "layers": []}`,
+		"algorithm": `{"schemaVersion": 2, "config": {"mediaType": "application/vnd.oci.image.config.v1+json",` +
+			`"digest": "md5:d41d8cd98f00b204e9800998ecf8427e", "size": 7023}, "layers": []}`,
+		"size": `{"schemaVersion": 2, "config": {"mediaType": "application/vnd.oci.image.config.v1+json",` +
+			`"digest": "` + testDigest + `", "size": -1}, "layers": []}`,
+		"size type": `{"schemaVersion": 2, "config": {"mediaType": "application/vnd.oci.image.config.v1+json",` +
+			`"digest": "` + testDigest + `", "size": "7023"}, "layers": []}`,
+		"media type": `{"schemaVersion": 2, "config": {"mediaType": "config",` +
+			`"digest": "` + testDigest + `", "size": 7023}, "layers": []}`,
+		"data": `{"schemaVersion": 2, "config": {"mediaType": "application/vnd.oci.image.config.v1+json",` +
+			`"digest": "` + testDigest + `", "size": 2, "data": "e30="}, "layers": []}`,
+		"artifact": `{"schemaVersion": 2, "config": {"mediaType": "` + MediaTypeOCIEmpty + `",` +
+			`"digest": "` + testDigest + `", "size": 2}, "layers": []}`,
+		"platform": `{"schemaVersion": 2, "manifests": [{"mediaType": "` + MediaTypeOCIManifest + `",` +
+			`"digest": "` + testDigest + `", "size": 2, "platform": {"os": "linux"}}]}`,
+		"subject": `{"schemaVersion": 2, "config": ` + descriptor + `, "layers": [], "subject": {}}`,
+		"docker media type": `{"schemaVersion": 2, "mediaType": "` + MediaTypeDockerManifest + `",` +
+			`"manifests": []}`,
+		"docker list platform": `{"schemaVersion": 2, "mediaType": "` + MediaTypeDockerList + `",` +
+			`"manifests": [{"mediaType": "` + MediaTypeDockerManifest + `", "digest": "` + testDigest + `", "size": 2}]}`,
+		"schema1": `{"schemaVersion": 1, "mediaType": "` + MediaTypeDockerSchema1 + `"}`,
+	}
+
+	for name, body := range invalid {
+		payload, err := Parse("", []byte(body))
+		is.Error(err, "an error was expected for %s", name)
+		is.Nil(payload)
+	}
+
+	payload, err := Parse(MediaTypeOCIIndex, read(is, "oci-manifest.json"))
+	is.Error(err)
+	is.Nil(payload)
+
+	payload, err = Parse(MediaTypeDockerManifest, []byte(`{"schemaVersion": 2, "config": `+descriptor+`, "layers": []}`))
+	is.Error(err)
+	is.Nil(payload)
+
+	payload, err = Parse(MediaTypeDockerList, read(is, "oci-index.json"))
+	is.Error(err)
+	is.Nil(payload)
+
+}
+
+func TestDescribe(t *testing.T) {
+
+	is := require.New(t)
+
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layer := []byte("layer")
+
+	m := &Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		Config:        DescriptorOf(MediaTypeOCIConfig, config),
+		Layers:        []Descriptor{DescriptorOf(MediaTypeOCILayerGzip, layer)},
+	}
+	is.NoError(m.Config.Verify(config))
+	is.Error(m.Config.Verify(layer))
+
+	body, err := Marshal(m)
+	is.NoError(err)
+
+	descriptor, err := Describe(m)
+	is.NoError(err)
+	is.Equal(MediaTypeOCIManifest, descriptor.MediaType)
+	is.Equal(int64(len(body)), descriptor.Size)
+	is.Equal(digest.FromBytes(body), descriptor.Digest)
+	is.NoError(descriptor.Verify(body))
+
+	payload, err := Parse(descriptor.MediaType, body)
+	is.NoError(err)
+	is.Equal(m, payload)
+
+	again, err := Describe(payload)
+	is.NoError(err)
+	is.Equal(descriptor, again)
+
+	artifact := &Manifest{
+		SchemaVersion: 2,
+		ArtifactType:  "application/vnd.example.sbom.v1+json",
+		Config:        DescriptorOf(MediaTypeOCIEmpty, []byte("{}")),
+		Layers:        []Descriptor{},
+		Subject:       &descriptor,
+	}
+	artifact.Config.Data = []byte("{}")
+
+	described, err := Describe(artifact)
+	is.NoError(err)
+	is.Equal(artifact.ArtifactType, described.ArtifactType)
+
+	index := &Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: []Descriptor{descriptor}}
+	index.Manifests[0].Platform = &Platform{OS: "linux", Architecture: "amd64"}
+	body, err = Marshal(index)
+	is.NoError(err)
+	is.True(strings.Contains(string(body), `"platform":{"architecture":"amd64","os":"linux"}`))
+
+	_, err = Describe(&Index{SchemaVersion: 2})
+	is.Error(err)
+
+	_, err = Marshal(&DockerManifest{SchemaVersion: 2, Config: descriptor, Layers: []Descriptor{}})
+	is.Error(err)
+
+	is.Equal(digest.Digest("sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"), digest.FromBytes(nil))
+	is.Equal(digest.SHA256, descriptor.Digest.Algorithm())
+	is.Len(descriptor.Digest.Hex(), 64)
+
+}
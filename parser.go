@@ -17,25 +17,42 @@
 package dockerparser
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 
+	"github.com/novln/docker-parser/distribution/digest"
+	"github.com/novln/docker-parser/distribution/reference"
 	"github.com/novln/docker-parser/docker"
 )
 
 // Reference is an opaque object that include identifier such as a name, tag, repository, registry, etc...
 type Reference struct {
-	named docker.Named
-	tag   string
+	// hostname is the registry hostname, with docker.io aliases already resolved.
+	hostname string
+	// name is the remote name, without the implicit "library/" prefix of official images.
+	name string
+	// tag is either ":" followed by a tag or "@" followed by a digest.
+	tag string
+	// implicit is true if no tag nor digest was given, and the default tag is used.
+	implicit bool
+	// unqualified is true if no registry was given, and the default hostname is used.
+	unqualified bool
+	// unnamespaced is true if the "library/" prefix of an official image wasn't given.
+	unnamespaced bool
 }
 
 // Name returns the image's name. (ie: debian[:8.2])
 func (r Reference) Name() string {
-	return r.named.RemoteName() + r.tag
+	return r.ShortName() + r.tag
 }
 
 // ShortName returns the image's name (ie: debian)
 func (r Reference) ShortName() string {
-	return r.named.RemoteName()
+	if r.hostname == docker.DefaultHostname && !strings.ContainsRune(r.name, '/') {
+		return docker.DefaultRepoPrefix + r.name
+	}
+	return r.name
 }
 
 // Tag returns the image's tag (or digest).
@@ -46,52 +63,391 @@ func (r Reference) Tag() string {
 	return ""
 }
 
+// HasDigest returns true if the image is identified by a digest rather than a tag.
+func (r Reference) HasDigest() bool {
+	return strings.HasPrefix(r.tag, "@")
+}
+
+// HasImplicitTag returns true if neither a tag nor a digest was given, and the default tag is used.
+func (r Reference) HasImplicitTag() bool {
+	return r.implicit
+}
+
+// HasImplicitRegistry returns true if no registry was given, and the default hostname is used.
+// (ie: debian or library/debian, but not docker.io/debian)
+func (r Reference) HasImplicitRegistry() bool {
+	return r.unqualified
+}
+
+// HasImplicitNamespace returns true if the image is an official image whose "library/" prefix wasn't
+// given. (ie: debian or docker.io/debian, but not library/debian)
+func (r Reference) HasImplicitNamespace() bool {
+	return r.unnamespaced
+}
+
 // Registry returns the image's registry. (ie: host[:port])
 func (r Reference) Registry() string {
-	return r.named.Hostname()
+	return r.hostname
 }
 
 // Repository returns the image's repository. (ie: registry/name)
 func (r Reference) Repository() string {
-	return r.named.FullName()
+	return r.hostname + "/" + r.ShortName()
+}
+
+// IsDockerHub returns true if the image's registry is Docker Hub, whether it was given as docker.io,
+// as index.docker.io, or implied.
+func (r Reference) IsDockerHub() bool {
+	return r.hostname == docker.DefaultHostname
+}
+
+// IsOfficialImage returns true if the image is an official image of Docker Hub, in the "library/"
+// namespace. (ie: debian, library/debian or docker.io/debian)
+func (r Reference) IsOfficialImage() bool {
+	return r.IsDockerHub() && !strings.ContainsRune(r.name, '/')
+}
+
+// Namespace returns the path components of the image before its last one, or an empty string if
+// there's none. (ie: library for debian, foo/bar for quay.io/foo/bar/baz)
+func (r Reference) Namespace() string {
+	path := r.RepositoryPath()
+	if i := strings.LastIndexByte(path, '/'); i != -1 {
+		return path[:i]
+	}
+	return ""
+}
+
+// RepositoryPath returns the image's repository without its registry, like ShortName. (ie:
+// library/debian or foo/bar)
+func (r Reference) RepositoryPath() string {
+	return r.ShortName()
+}
+
+// PathComponents returns the path components of the image's repository, without its registry.
+// (ie: [library debian] or [foo bar baz])
+func (r Reference) PathComponents() []string {
+	return strings.Split(r.RepositoryPath(), "/")
 }
 
 // Remote returns the image's remote identifier. (ie: registry/name[:tag])
 func (r Reference) Remote() string {
-	return r.named.FullName() + r.tag
+	return r.Repository() + r.tag
 }
 
-func clean(url string) string {
+// WithTag returns a copy of the reference identified by the given tag instead of its current tag
+// or digest.
+func (r Reference) WithTag(tag string) (*Reference, error) {
+	if !isTag(tag) {
+		return nil, reference.ErrTagInvalidFormat
+	}
+	return &Reference{
+		hostname:     r.hostname,
+		name:         r.name,
+		tag:          ":" + tag,
+		unqualified:  r.unqualified,
+		unnamespaced: r.unnamespaced,
+	}, nil
+}
 
-	s := url
+// WithDigest returns a copy of the reference identified by the given digest instead of its current
+// tag or digest.
+func (r Reference) WithDigest(d digest.Digest) (*Reference, error) {
+	if !isDigest(d.String()) {
+		return nil, reference.ErrDigestInvalidFormat
+	}
+	return &Reference{
+		hostname:     r.hostname,
+		name:         r.name,
+		tag:          "@" + d.String(),
+		unqualified:  r.unqualified,
+		unnamespaced: r.unnamespaced,
+	}, nil
+}
+
+func clean(url string) string {
 
 	if strings.HasPrefix(url, "http://") {
-		s = strings.Replace(url, "http://", "", 1)
-	} else if strings.HasPrefix(url, "https://") {
-		s = strings.Replace(url, "https://", "", 1)
+		return url[len("http://"):]
+	}
+	if strings.HasPrefix(url, "https://") {
+		return url[len("https://"):]
 	}
 
-	return s
+	return url
 }
 
 // Parse returns a Reference from analyzing the given remote identifier.
 func Parse(remote string) (*Reference, error) {
 
-	n, err := docker.ParseNamed(clean(remote))
+	reference := &Reference{}
 
+	err := ParseInto(reference, remote)
 	if err != nil {
 		return nil, err
 	}
 
-	n = docker.WithDefaultTag(n)
+	return reference, nil
+}
+
+// ParseInto analyzes the given remote identifier and stores the result in dst.
+//
+// Unlike Parse, it doesn't allocate on success: the components of dst are slices of the given
+// remote identifier, or package constants when they are implied. It's meant to be used on hot paths,
+// with a Reference reused between calls. On error, dst is left untouched.
+func ParseInto(dst *Reference, remote string) error {
+
+	s := clean(remote)
+
+	name, tag, hash := s, "", ""
+
+	if i := strings.IndexByte(name, '@'); i != -1 {
+		name, hash = name[:i], name[i:]
+		if !isDigest(hash[1:]) {
+			return errInvalidReference(s)
+		}
+	}
+
+	if i := strings.LastIndexByte(name, ':'); i > strings.LastIndexByte(name, '/') {
+		name, tag = name[:i], name[i:]
+		if !isTag(tag[1:]) {
+			return errInvalidReference(s)
+		}
+	}
+
+	if len(name) > reference.NameTotalLengthMax || !isName(name) {
+		return errInvalidReference(s)
+	}
+
+	unqualified := !hasHostname(name)
+	hostname, remoteName := splitHostname(name)
+	if hasUpper(remoteName) {
+		return errors.New("invalid reference format: repository name must be lowercase")
+	}
+
+	// Official images are normalized without the default hostname nor the "library/" prefix, and the
+	// remaining name is then split again: this mimics docker's behavior for names like "docker.io/foo.com/bar".
+	namespaced := false
+	if hostname == docker.DefaultHostname {
+		namespaced = strings.HasPrefix(remoteName, docker.DefaultRepoPrefix)
+		remoteName = strings.TrimPrefix(remoteName, docker.DefaultRepoPrefix)
+		if isHexID(remoteName) {
+			return fmt.Errorf("Invalid repository name (%s), cannot specify 64-byte hexadecimal strings", remoteName)
+		}
+		hostname, remoteName = splitHostname(remoteName)
+	}
+
+	implicit := false
+	switch {
+	case hash != "":
+		tag = hash
+	case tag == "":
+		tag, implicit = ":"+docker.DefaultTag, true
+	}
+
+	dst.hostname = hostname
+	dst.name = remoteName
+	dst.tag = tag
+	dst.implicit = implicit
+	dst.unqualified = unqualified
+	dst.unnamespaced = !namespaced && hostname == docker.DefaultHostname && !strings.ContainsRune(remoteName, '/')
+
+	return nil
+}
+
+func errInvalidReference(s string) error {
+	return fmt.Errorf("Error parsing reference: %q is not a valid repository/tag", s)
+}
 
-	var t string
-	switch x := n.(type) {
-	case docker.Canonical:
-		t = "@" + x.Digest().String()
-	case docker.NamedTagged:
-		t = ":" + x.Tag()
+// splitHostname splits a repository name to hostname and remote name, without adding the "library/"
+// prefix of official images. If no valid hostname is found, the default hostname is used.
+func splitHostname(name string) (hostname, remoteName string) {
+	if !hasHostname(name) {
+		hostname, remoteName = docker.DefaultHostname, name
+	} else {
+		i := strings.IndexByte(name, '/')
+		hostname, remoteName = name[:i], name[i+1:]
 	}
+	if hostname == docker.LegacyDefaultHostname {
+		hostname = docker.DefaultHostname
+	}
+	return hostname, remoteName
+}
+
+// hasHostname reports whether the first component of a repository name is a hostname.
+func hasHostname(name string) bool {
+	i := strings.IndexByte(name, '/')
+	return i != -1 && (strings.ContainsAny(name[:i], ".:") || name[:i] == "localhost")
+}
+
+// isName reports whether s is a repository name, with an optional hostname, as defined by
+// reference.NameRegexp.
+func isName(s string) bool {
+	if isPath(s) {
+		return true
+	}
+	i := strings.IndexByte(s, '/')
+	return i != -1 && isHostname(s[:i]) && isPath(s[i+1:])
+}
+
+// isPath reports whether s is a list of path components separated by a slash.
+func isPath(s string) bool {
+	for {
+		i := strings.IndexByte(s, '/')
+		if i == -1 {
+			return isComponent(s)
+		}
+		if !isComponent(s[:i]) {
+			return false
+		}
+		s = s[i+1:]
+	}
+}
+
+// isComponent reports whether s is a path component: lowercase alpha-numeric runs separated by
+// one period, one or two underscores, or any number of dashes.
+func isComponent(s string) bool {
+	if s == "" || !isAlphaNum(s[0]) || !isAlphaNum(s[len(s)-1]) {
+		return false
+	}
+	for i := 0; i < len(s); {
+		if isAlphaNum(s[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && !isAlphaNum(s[j]) {
+			j++
+		}
+		switch sep := s[i:j]; {
+		case sep == ".", sep == "_", sep == "__":
+		case strings.Trim(sep, "-") == "":
+		default:
+			return false
+		}
+		i = j
+	}
+	return true
+}
+
+// isHostname reports whether s is a hostname, with an optional port number.
+func isHostname(s string) bool {
+	if i := strings.IndexByte(s, ':'); i != -1 {
+		if !isNumeric(s[i+1:]) {
+			return false
+		}
+		s = s[:i]
+	}
+	for {
+		i := strings.IndexByte(s, '.')
+		if i == -1 {
+			return isHostnameComponent(s)
+		}
+		if !isHostnameComponent(s[:i]) {
+			return false
+		}
+		s = s[i+1:]
+	}
+}
+
+func isHostnameComponent(s string) bool {
+	if s == "" || s[0] == '-' || s[len(s)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isLetter(s[i]) && !isDigit(s[i]) && s[i] != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// isTag reports whether s is a tag, as defined by reference.TagRegexp.
+func isTag(s string) bool {
+	if s == "" || len(s) > 128 || s[0] == '.' || s[0] == '-' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isWord(s[i]) && s[i] != '.' && s[i] != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// isDigest reports whether s is a digest using a supported algorithm.
+func isDigest(s string) bool {
+	i := strings.IndexByte(s, ':')
+	if i == -1 {
+		return false
+	}
+	switch s[:i] {
+	case "sha256":
+		return len(s[i+1:]) == 64 && isHex(s[i+1:])
+	case "sha384":
+		return len(s[i+1:]) == 96 && isHex(s[i+1:])
+	case "sha512":
+		return len(s[i+1:]) == 128 && isHex(s[i+1:])
+	default:
+		return false
+	}
+}
+
+// isHexID reports whether s looks like an image ID, as defined by docker.ValidateID.
+func isHexID(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) && (s[i] < 'a' || s[i] > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20
+		if !isDigit(s[i]) && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasUpper(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 'A' && s[i] <= 'Z' {
+			return true
+		}
+	}
+	return false
+}
+
+func isAlphaNum(c byte) bool {
+	return (c >= 'a' && c <= 'z') || isDigit(c)
+}
+
+func isWord(c byte) bool {
+	return isLetter(c) || isDigit(c) || c == '_'
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
 
-	return &Reference{named: n, tag: t}, nil
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
 }
@@ -0,0 +1,241 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dockerparser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/novln/docker-parser/docker"
+)
+
+// Pattern matches references, in order to configure mirrors, policies or credentials.
+// (ie: *.gcr.io/project/**, docker.io/library/*:1.*, registry.local:5000/team/*@sha256:*)
+//
+// A pattern has the same structure as a reference: a registry, a name, and an optional tag or digest.
+// In the registry, "*" matches any sequence of characters within a host label and "**" matches one
+// or more host labels. In the name, "*" matches any sequence of characters within a path component
+// and "**" matches zero or more path components. In the tag or digest, "*" matches any sequence of
+// characters. A pattern without tag nor digest matches any tag or digest.
+//
+// Like references, a pattern without registry applies to docker.io, and single component names are
+// official images: "debian:*" is the same pattern as "docker.io/library/debian:*". However, a first
+// component with a wildcard is always a registry. Finally, "**" alone matches every reference.
+type Pattern struct {
+	raw    string
+	host   []string
+	port   string
+	path   []string
+	tag    string
+	digest string
+}
+
+// ParsePattern returns a Pattern from analyzing the given string.
+func ParsePattern(s string) (*Pattern, error) {
+
+	p := &Pattern{raw: s}
+	name := s
+
+	if i := strings.IndexByte(name, '@'); i != -1 {
+		name, p.digest = name[:i], name[i+1:]
+		if p.digest == "" {
+			return nil, errInvalidPattern(s, "empty digest")
+		}
+	}
+
+	if i := strings.LastIndexByte(name, ':'); i > strings.LastIndexByte(name, '/') {
+		name, p.tag = name[:i], name[i+1:]
+		if p.tag == "" {
+			return nil, errInvalidPattern(s, "empty tag")
+		}
+		if p.digest != "" {
+			return nil, errInvalidPattern(s, "both tag and digest")
+		}
+	}
+
+	if name == "**" {
+		p.host, p.port, p.path = []string{"**"}, "*", []string{"**"}
+		return p, nil
+	}
+
+	segments := strings.Split(name, "/")
+	host := docker.DefaultHostname
+	if first := segments[0]; len(segments) > 1 && (strings.ContainsAny(first, ".:*") || first == "localhost") {
+		host, segments = first, segments[1:]
+	}
+	if host == docker.LegacyDefaultHostname {
+		host = docker.DefaultHostname
+	}
+	if host == docker.DefaultHostname && len(segments) == 1 && !strings.Contains(segments[0], "*") {
+		segments = []string{strings.TrimSuffix(docker.DefaultRepoPrefix, "/"), segments[0]}
+	}
+
+	if i := strings.IndexByte(host, ':'); i != -1 {
+		host, p.port = host[:i], host[i+1:]
+		if p.port == "" {
+			return nil, errInvalidPattern(s, "empty port")
+		}
+	}
+
+	p.host = strings.Split(strings.ToLower(host), ".")
+	for _, label := range p.host {
+		if label == "" || (strings.Contains(label, "**") && label != "**") {
+			return nil, errInvalidPattern(s, "invalid registry")
+		}
+	}
+
+	p.path = segments
+	for _, component := range p.path {
+		if component == "" || (strings.Contains(component, "**") && component != "**") {
+			return nil, errInvalidPattern(s, "invalid name")
+		}
+	}
+
+	return p, nil
+}
+
+func errInvalidPattern(s, reason string) error {
+	return fmt.Errorf("invalid pattern %q: %s", s, reason)
+}
+
+// String returns the pattern as it was given.
+func (p Pattern) String() string {
+	return p.raw
+}
+
+// Match returns true if the given reference matches the pattern.
+func (p Pattern) Match(r *Reference) bool {
+
+	host, port := r.Registry(), ""
+	if i := strings.IndexByte(host, ':'); i != -1 {
+		host, port = host[:i], host[i+1:]
+	}
+
+	if !glob(p.port, port) {
+		return false
+	}
+	if !matchSegments(p.host, strings.Split(strings.ToLower(host), "."), 1) {
+		return false
+	}
+	if !matchSegments(p.path, r.PathComponents(), 0) {
+		return false
+	}
+
+	switch {
+	case p.tag != "":
+		return !r.HasDigest() && glob(p.tag, r.Tag())
+	case p.digest != "":
+		return r.HasDigest() && glob(p.digest, r.Tag())
+	default:
+		return true
+	}
+}
+
+// Specificity returns a score that is higher for more specific patterns, so that the most specific
+// pattern can win when several of them match a reference. Literal segments are more specific than
+// segments with a wildcard, which are more specific than "*" segments. "**" segments don't count.
+// Ties are broken by the number of literal characters.
+func (p Pattern) Specificity() int {
+
+	exact, partial, wild, chars := 0, 0, 0, 0
+
+	count := func(segment string) {
+		switch {
+		case segment == "" || segment == "**":
+		case segment == "*":
+			wild++
+		case strings.Contains(segment, "*"):
+			partial++
+			chars += len(strings.Replace(segment, "*", "", -1))
+		default:
+			exact++
+			chars += len(segment)
+		}
+	}
+
+	for _, label := range p.host {
+		count(label)
+	}
+	count(p.port)
+	for _, component := range p.path {
+		count(component)
+	}
+	count(p.tag)
+	count(p.digest)
+
+	if chars > 999 {
+		chars = 999
+	}
+
+	return ((exact*100+partial)*100+wild)*1000 + chars
+}
+
+// MostSpecific returns the most specific pattern matching the given reference, or nil if none does.
+// If several patterns are as specific, the first one wins.
+func MostSpecific(r *Reference, patterns ...*Pattern) *Pattern {
+
+	var best *Pattern
+
+	for _, p := range patterns {
+		if p.Match(r) && (best == nil || p.Specificity() > best.Specificity()) {
+			best = p
+		}
+	}
+
+	return best
+}
+
+// matchSegments returns true if the segments match the patterns, where "**" matches at least min
+// segments.
+func matchSegments(patterns, segments []string, min int) bool {
+
+	if len(patterns) == 0 {
+		return len(segments) == 0
+	}
+
+	if patterns[0] == "**" {
+		for i := min; i <= len(segments); i++ {
+			if matchSegments(patterns[1:], segments[i:], min) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return len(segments) > 0 && glob(patterns[0], segments[0]) && matchSegments(patterns[1:], segments[1:], min)
+}
+
+// glob returns true if s matches the pattern, where "*" matches any sequence of characters.
+func glob(pattern, s string) bool {
+
+	i := strings.IndexByte(pattern, '*')
+	if i == -1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, pattern[:i]) {
+		return false
+	}
+
+	pattern, s = pattern[i+1:], s[i:]
+	for j := 0; j <= len(s); j++ {
+		if glob(pattern, s[j:]) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,108 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package dockerparser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPatternMatch(t *testing.T) {
+
+	is := require.New(t)
+
+	tests := []struct {
+		pattern  string
+		remote   string
+		expected bool
+	}{
+		{"*.gcr.io/project/**", "eu.gcr.io/project/app:1.0", true},
+		{"*.gcr.io/project/**", "eu.gcr.io/project/team/app@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb", true},
+		{"*.gcr.io/project/**", "gcr.io/project/app", false},
+		{"*.gcr.io/project/**", "eu.gcr.io/other/app", false},
+		{"**.gcr.io/**", "a.b.gcr.io/app", true},
+		{"docker.io/library/*:1.*", "debian:1.2", true},
+		{"docker.io/library/*:1.*", "index.docker.io/library/debian:1.2", true},
+		{"docker.io/library/*:1.*", "debian:2.0", false},
+		{"docker.io/library/*:1.*", "debian", false},
+		{"docker.io/library/*:1.*", "foo/debian:1.2", false},
+		{"debian", "docker.io/library/debian:10", true},
+		{"debian:*", "debian@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb", false},
+		{"registry.local:5000/team/*@sha256:*", "registry.local:5000/team/app@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb", true},
+		{"registry.local:5000/team/*@sha256:*", "registry.local:5000/team/app:1.0", false},
+		{"registry.local:5000/team/*@sha256:*", "registry.local/team/app@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb", false},
+		{"registry.local:*/team/app-*", "Registry.Local:5001/team/app-api", true},
+		{"registry.local/team/**", "registry.local:5000/team/app", false},
+		{"quay.io/**/app", "quay.io/app", true},
+		{"quay.io/**/app", "quay.io/a/b/app", true},
+		{"quay.io/**/app", "quay.io/a/b/app2", false},
+		{"**", "localhost/foo", true},
+	}
+
+	for _, test := range tests {
+		pattern, err := ParsePattern(test.pattern)
+		is.NoError(err, "parse error was not expected for %s", test.pattern)
+		is.Equal(test.pattern, pattern.String())
+
+		reference := parse(is, test.remote)
+		is.Equal(test.expected, pattern.Match(reference), "unexpected match of %s with %s", test.pattern, test.remote)
+	}
+
+}
+
+func TestParsePatternError(t *testing.T) {
+
+	is := require.New(t)
+
+	for _, s := range []string{"foo:", "foo@", "foo:1@sha256:*", "foo//bar", "foo.com:/bar", "foo.a**.com/bar", "foo/a**"} {
+		pattern, err := ParsePattern(s)
+		is.Error(err, "an error was expected for %s", s)
+		is.Nil(pattern)
+	}
+
+}
+
+func TestMostSpecific(t *testing.T) {
+
+	is := require.New(t)
+
+	patterns := []*Pattern{}
+	for _, s := range []string{"**", "*.gcr.io/**", "eu.gcr.io/**", "eu.gcr.io/project/**", "eu.gcr.io/project/app-*", "eu.gcr.io/project/*"} {
+		pattern, err := ParsePattern(s)
+		is.NoError(err)
+		patterns = append(patterns, pattern)
+	}
+
+	tests := map[string]string{
+		"eu.gcr.io/project/app-api": "eu.gcr.io/project/app-*",
+		"eu.gcr.io/project/worker":  "eu.gcr.io/project/*",
+		"eu.gcr.io/project/a/b":     "eu.gcr.io/project/**",
+		"eu.gcr.io/other/app":       "eu.gcr.io/**",
+		"us.gcr.io/project/app":     "*.gcr.io/**",
+		"debian":                    "**",
+	}
+
+	for remote, expected := range tests {
+		pattern := MostSpecific(parse(is, remote), patterns...)
+		is.NotNil(pattern)
+		is.Equal(expected, pattern.String(), "unexpected pattern for %s", remote)
+	}
+
+	is.Nil(MostSpecific(parse(is, "debian"), patterns[1:]...))
+
+}
@@ -0,0 +1,280 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package platform parses platform specifiers, such as linux/arm64/v8 or windows/amd64:10.0.17763,
+// and selects the manifest of a platform from an OCI index or a Docker manifest list, with the
+// variant fallbacks of containerd: an arm/v7 host runs arm/v6 and arm/v5 images, an arm64 host runs
+// arm images, and an amd64 host runs 386 images.
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/manifest"
+)
+
+// ErrNoMatch is returned when no manifest of an index matches a platform.
+var ErrNoMatch = errors.New("no manifest matches the platform")
+
+// componentRegexp matches the operating system, architecture and variant of a specifier.
+var componentRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// versionRegexp matches the operating system version of a specifier.
+var versionRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// knownOS are the operating systems, as GOOS, and their aliases.
+var knownOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true, "hurd": true,
+	"illumos": true, "ios": true, "js": true, "linux": true, "macos": true, "netbsd": true,
+	"openbsd": true, "plan9": true, "solaris": true, "wasip1": true, "windows": true, "zos": true,
+}
+
+// knownArchitectures are the architectures, as GOARCH, and their aliases.
+var knownArchitectures = map[string]bool{
+	"386": true, "amd64": true, "arm": true, "arm64": true, "loong64": true, "mips": true,
+	"mipsle": true, "mips64": true, "mips64le": true, "ppc64": true, "ppc64le": true,
+	"riscv64": true, "s390x": true, "wasm": true, "i386": true, "x86_64": true, "x86-64": true,
+	"aarch64": true, "armhf": true, "armel": true,
+}
+
+// Parse reads a platform specifier: os/architecture[/variant], with an optional :os.version
+// suffix. (ie: linux/arm64/v8 or windows/amd64:10.0.17763) A specifier with a single component is
+// either an operating system or an architecture, completed with the platform of the current
+// process. The platform is normalized.
+func Parse(specifier string) (manifest.Platform, error) {
+
+	platform := manifest.Platform{}
+
+	parts := strings.SplitN(specifier, ":", 2)
+	if len(parts) == 2 {
+		if !versionRegexp.MatchString(parts[1]) {
+			return platform, fmt.Errorf("invalid platform %q: invalid os version", specifier)
+		}
+		platform.OSVersion = parts[1]
+	}
+
+	components := strings.Split(strings.ToLower(parts[0]), "/")
+	for _, component := range components {
+		if !componentRegexp.MatchString(component) {
+			return platform, fmt.Errorf("invalid platform %q", specifier)
+		}
+	}
+
+	switch len(components) {
+	case 1:
+		switch {
+		case knownOS[components[0]]:
+			platform.OS, platform.Architecture = components[0], runtime.GOARCH
+		case knownArchitectures[components[0]]:
+			platform.OS, platform.Architecture = runtime.GOOS, components[0]
+		default:
+			return platform, fmt.Errorf("invalid platform %q: unknown operating system or architecture", specifier)
+		}
+	case 3:
+		platform.Variant = components[2]
+		fallthrough
+	case 2:
+		platform.OS, platform.Architecture = components[0], components[1]
+	default:
+		return platform, fmt.Errorf("invalid platform %q", specifier)
+	}
+
+	return Normalize(platform), nil
+}
+
+// Default returns the platform of the current process.
+func Default() manifest.Platform {
+	return Normalize(manifest.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH})
+}
+
+// Normalize returns the platform with the canonical names of its operating system, architecture
+// and variant: aarch64 is arm64, x86_64 is amd64, armhf is arm/v7, and default variants, such as
+// v8 for arm64, are omitted except v7 for arm.
+func Normalize(platform manifest.Platform) manifest.Platform {
+
+	platform.OS = strings.ToLower(platform.OS)
+	if platform.OS == "macos" {
+		platform.OS = "darwin"
+	}
+
+	platform.Architecture = strings.ToLower(platform.Architecture)
+	platform.Variant = strings.ToLower(platform.Variant)
+
+	switch platform.Architecture {
+	case "i386":
+		platform.Architecture, platform.Variant = "386", ""
+	case "x86_64", "x86-64", "amd64":
+		platform.Architecture = "amd64"
+		if platform.Variant == "v1" {
+			platform.Variant = ""
+		}
+	case "aarch64", "arm64":
+		platform.Architecture = "arm64"
+		switch platform.Variant {
+		case "8", "v8", "v8.0":
+			platform.Variant = ""
+		}
+	case "armhf":
+		platform.Architecture, platform.Variant = "arm", "v7"
+	case "armel":
+		platform.Architecture, platform.Variant = "arm", "v6"
+	case "arm":
+		switch platform.Variant {
+		case "", "7":
+			platform.Variant = "v7"
+		case "5", "6", "8":
+			platform.Variant = "v" + platform.Variant
+		}
+	}
+
+	return platform
+}
+
+// Format returns the specifier of the platform, the reverse of Parse.
+func Format(platform manifest.Platform) string {
+
+	specifier := platform.OS + "/" + platform.Architecture
+	if platform.Variant != "" {
+		specifier += "/" + platform.Variant
+	}
+	if platform.OSVersion != "" {
+		specifier += ":" + platform.OSVersion
+	}
+
+	return specifier
+}
+
+// Compatible returns the platforms of the images that run on the given platform, in order of
+// preference, starting with the platform itself.
+func Compatible(platform manifest.Platform) []manifest.Platform {
+
+	platform = Normalize(platform)
+	with := func(architecture, variant string) manifest.Platform {
+		compatible := platform
+		compatible.Architecture, compatible.Variant = architecture, variant
+		return compatible
+	}
+
+	vector := []manifest.Platform{platform}
+
+	switch platform.Architecture {
+	case "amd64":
+		if level, ok := level(platform.Variant, 1); ok {
+			for l := level - 1; l > 1; l-- {
+				vector = append(vector, with("amd64", "v"+strconv.Itoa(l)))
+			}
+			if level > 1 {
+				vector = append(vector, with("amd64", ""))
+			}
+		}
+		vector = append(vector, with("386", ""))
+	case "arm64":
+		if platform.Variant != "" {
+			vector = append(vector, with("arm64", ""))
+		}
+		for l := 8; l >= 5; l-- {
+			vector = append(vector, with("arm", "v"+strconv.Itoa(l)))
+		}
+	case "arm":
+		if level, ok := level(platform.Variant, 7); ok {
+			for l := level - 1; l >= 5; l-- {
+				vector = append(vector, with("arm", "v"+strconv.Itoa(l)))
+			}
+		}
+	}
+
+	return vector
+}
+
+// level returns the level of a variant such as v7, or the given default level for an empty
+// variant.
+func level(variant string, defaultLevel int) (int, bool) {
+
+	if variant == "" {
+		return defaultLevel, true
+	}
+	if !strings.HasPrefix(variant, "v") {
+		return 0, false
+	}
+
+	l, err := strconv.Atoi(variant[1:])
+	return l, err == nil
+}
+
+// Match returns true if the platform of an image is exactly the requested one, once both are
+// normalized. If both have an operating system version, their major, minor and build numbers must
+// be equal, so that windows/amd64:10.0.17763 matches an image for 10.0.17763.1040.
+func Match(requested, image manifest.Platform) bool {
+
+	requested, image = Normalize(requested), Normalize(image)
+	if requested.OS != image.OS || requested.Architecture != image.Architecture ||
+		requested.Variant != image.Variant {
+		return false
+	}
+
+	if requested.OSVersion != "" && image.OSVersion != "" {
+		return build(requested.OSVersion) == build(image.OSVersion)
+	}
+
+	return true
+}
+
+// build returns the major, minor and build numbers of an operating system version.
+func build(version string) string {
+	return strings.Join(append(strings.SplitN(version, ".", 4), "", "", "")[:3], ".")
+}
+
+// Select returns the descriptor of the manifest of an OCI index or a Docker manifest list which
+// suits the platform best: the first manifest matching the platform itself, otherwise a compatible
+// one, in the order of Compatible. Manifests without platform are ignored.
+func Select(payload manifest.Payload, platform manifest.Platform) (manifest.Descriptor, error) {
+
+	switch payload.(type) {
+	case *manifest.Index, *manifest.DockerList:
+	default:
+		return manifest.Descriptor{}, fmt.Errorf("%s isn't an index nor a manifest list", payload.Type())
+	}
+
+	descriptors := payload.Descriptors()
+	for _, compatible := range Compatible(platform) {
+		for _, descriptor := range descriptors {
+			if descriptor.Platform != nil && Match(compatible, *descriptor.Platform) {
+				return descriptor, nil
+			}
+		}
+	}
+
+	return manifest.Descriptor{}, fmt.Errorf("%s: %s", Format(platform), ErrNoMatch)
+}
+
+// SelectReference returns the reference, pinned to the digest of the manifest selected by Select
+// from the given index, which is the one of the reference.
+func SelectReference(ref *dockerparser.Reference, payload manifest.Payload,
+	platform manifest.Platform) (*dockerparser.Reference, error) {
+
+	descriptor, err := Select(payload, platform)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", ref.Remote(), err)
+	}
+
+	return ref.WithDigest(descriptor.Digest)
+}
@@ -0,0 +1,202 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package platform
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+// Digests of the manifests of testdata/index.json, in order.
+var digests = []string{
+	"sha256:5feceb66ffc86f38d952786c6d696c79c2dbc239dd4e91b46729d73a27fb57e9", // linux/amd64
+	"sha256:6b86b273ff34fce19d6b804eff5a3f5747ada4eaa22f1d49c01e52ddb7875b4b", // linux/arm/v6
+	"sha256:d4735e3a265e16eee03f59718b9b5d03019c07d8b6c51f90da3a666eec13ab35", // linux/arm/v7
+	"sha256:4e07408562bedb8b60ce05c1decfe3ad16b72230967de01f640b7e4729b49fce", // linux/arm64/v8
+	"sha256:4b227777d4dd1fc61c6f884f48641d02b4d121d3fd328cb08b5531fcacdabf8a", // linux/386
+	"sha256:ef2d127de37b942baad06145e54b0c619a1f22327b2ebbcfbec78f5564afe39d", // windows/amd64:10.0.17763.1040
+	"sha256:e7f6c011776e8db7cd330b54174fd76f7d0216b612387a5ffcfb81e6f0919683", // windows/amd64:10.0.20348.2113
+}
+
+func index(is *require.Assertions) manifest.Payload {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", "index.json"))
+	is.NoError(err)
+	payload, err := manifest.Parse("", body)
+	is.NoError(err)
+	return payload
+}
+
+func parse(is *require.Assertions, specifier string) manifest.Platform {
+	platform, err := Parse(specifier)
+	is.NoError(err)
+	return platform
+}
+
+func TestParse(t *testing.T) {
+
+	is := require.New(t)
+
+	tests := map[string]string{
+		"linux/amd64":              "linux/amd64",
+		"Linux/x86_64":             "linux/amd64",
+		"linux/amd64/v1":           "linux/amd64",
+		"linux/amd64/v3":           "linux/amd64/v3",
+		"linux/arm64/v8":           "linux/arm64",
+		"linux/aarch64":            "linux/arm64",
+		"linux/arm64/v9":           "linux/arm64/v9",
+		"linux/armhf":              "linux/arm/v7",
+		"linux/armel":              "linux/arm/v6",
+		"linux/arm":                "linux/arm/v7",
+		"linux/arm/6":              "linux/arm/v6",
+		"linux/i386":               "linux/386",
+		"macos/arm64":              "darwin/arm64",
+		"windows/amd64:10.0.17763": "windows/amd64:10.0.17763",
+		"linux/s390x":              "linux/s390x",
+		"linux":                    "linux/" + runtime.GOARCH,
+		"arm64":                    runtime.GOOS + "/arm64",
+	}
+
+	for specifier, expected := range tests {
+		platform, err := Parse(specifier)
+		is.NoError(err, "parse error was not expected for %s", specifier)
+		is.Equal(expected, Format(platform))
+	}
+
+	platform := parse(is, "windows/amd64:10.0.17763")
+	is.Equal(manifest.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763"}, platform)
+
+	invalid := []string{
+		"",
+		"linux/",
+		"linux/arm/v7/extra",
+		"linux/arm:",
+		"linux/arm:10 0",
+		"linux/amd 64",
+		"amiga",
+	}
+
+	for _, specifier := range invalid {
+		_, err := Parse(specifier)
+		is.Error(err, "an error was expected for %s", specifier)
+	}
+
+	is.Equal(Normalize(manifest.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}), Default())
+
+}
+
+func TestCompatible(t *testing.T) {
+
+	is := require.New(t)
+
+	tests := map[string][]string{
+		"linux/amd64":    {"linux/amd64", "linux/386"},
+		"linux/amd64/v3": {"linux/amd64/v3", "linux/amd64/v2", "linux/amd64", "linux/386"},
+		"linux/arm64":    {"linux/arm64", "linux/arm/v8", "linux/arm/v7", "linux/arm/v6", "linux/arm/v5"},
+		"linux/arm/v7":   {"linux/arm/v7", "linux/arm/v6", "linux/arm/v5"},
+		"linux/arm/v5":   {"linux/arm/v5"},
+		"linux/riscv64":  {"linux/riscv64"},
+	}
+
+	for specifier, expected := range tests {
+		specifiers := []string{}
+		for _, platform := range Compatible(parse(is, specifier)) {
+			specifiers = append(specifiers, Format(platform))
+		}
+		is.Equal(expected, specifiers, "unexpected compatible platforms for %s", specifier)
+	}
+
+}
+
+func TestMatch(t *testing.T) {
+
+	is := require.New(t)
+
+	image := manifest.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.1040"}
+
+	is.True(Match(parse(is, "windows/amd64"), image))
+	is.True(Match(parse(is, "windows/amd64:10.0.17763"), image))
+	is.True(Match(parse(is, "windows/amd64:10.0.17763.2000"), image))
+	is.False(Match(parse(is, "windows/amd64:10.0.20348"), image))
+	is.False(Match(parse(is, "linux/amd64"), image))
+
+	is.True(Match(parse(is, "linux/arm64"), manifest.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}))
+	is.True(Match(parse(is, "linux/armhf"), manifest.Platform{OS: "linux", Architecture: "arm"}))
+	is.False(Match(parse(is, "linux/arm/v6"), manifest.Platform{OS: "linux", Architecture: "arm"}))
+
+}
+
+func TestSelect(t *testing.T) {
+
+	is := require.New(t)
+
+	payload := index(is)
+
+	tests := map[string]string{
+		"linux/amd64":              digests[0],
+		"linux/x86_64/v3":          digests[0],
+		"linux/arm/v6":             digests[1],
+		"linux/arm/v7":             digests[2],
+		"linux/arm/v8":             digests[2],
+		"linux/aarch64":            digests[3],
+		"linux/386":                digests[4],
+		"windows/amd64":            digests[5],
+		"windows/amd64:10.0.20348": digests[6],
+	}
+
+	for specifier, expected := range tests {
+		descriptor, err := Select(payload, parse(is, specifier))
+		is.NoError(err, "select error was not expected for %s", specifier)
+		is.Equal(expected, descriptor.Digest.String(), "unexpected manifest for %s", specifier)
+	}
+
+	for _, specifier := range []string{"linux/arm/v5", "linux/s390x", "windows/amd64:10.0.14393", "darwin/arm64"} {
+		_, err := Select(payload, parse(is, specifier))
+		is.Error(err, "an error was expected for %s", specifier)
+		is.Contains(err.Error(), ErrNoMatch.Error())
+	}
+
+	// Without the linux/arm64 manifest, arm64 hosts fall back to arm.
+	list := &manifest.DockerList{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeDockerList,
+		Manifests:     append([]manifest.Descriptor{}, payload.Descriptors()[:3]...),
+	}
+	descriptor, err := Select(list, parse(is, "linux/arm64"))
+	is.NoError(err)
+	is.Equal(digests[2], descriptor.Digest.String())
+
+	_, err = Select(&manifest.Manifest{SchemaVersion: 2}, parse(is, "linux/amd64"))
+	is.Error(err)
+
+	ref, err := dockerparser.Parse("team/app:1.0")
+	is.NoError(err)
+
+	pinned, err := SelectReference(ref, payload, parse(is, "linux/arm64"))
+	is.NoError(err)
+	is.Equal("docker.io/team/app@"+digests[3], pinned.Remote())
+
+	pinned, err = SelectReference(ref, payload, parse(is, "linux/s390x"))
+	is.Error(err)
+	is.Nil(pinned)
+
+}
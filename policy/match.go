@@ -0,0 +1,122 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package policy
+
+import (
+	"regexp"
+	"strings"
+
+	dockerparser "github.com/novln/docker-parser"
+)
+
+// RegexpPrefix is the prefix of a pattern using a regular expression instead of a glob.
+const RegexpPrefix = "regex:"
+
+// component is the part of references matched by the patterns of a rule.
+type component int
+
+const (
+	registryComponent component = iota
+	repositoryComponent
+	tagComponent
+)
+
+// of returns the component of the given reference.
+func (c component) of(reference *dockerparser.Reference) string {
+	switch c {
+	case registryComponent:
+		return reference.Registry()
+	case tagComponent:
+		return reference.Tag()
+	default:
+		return reference.Repository()
+	}
+}
+
+// pattern returns the reference pattern matching references whose component matches the glob.
+func (c component) pattern(glob string) string {
+	switch c {
+	case registryComponent:
+		return glob + "/**"
+	case tagComponent:
+		return "**:" + glob
+	default:
+		return glob
+	}
+}
+
+// matcher matches a component of a reference, such as its registry, repository or tag.
+type matcher struct {
+	component component
+	pattern   *dockerparser.Pattern
+	regexp    *regexp.Regexp
+}
+
+// compile returns a matcher of the given component, for a pattern which is either a glob or a
+// regular expression prefixed by RegexpPrefix.
+//
+// Globs are matched with dockerparser.Pattern: a registry glob is the registry of a pattern
+// matching any repository, and a tag glob is the tag of a pattern matching any repository.
+// Regular expressions are matched against the component as a string.
+func compile(pattern string, c component) (matcher, error) {
+
+	if strings.HasPrefix(pattern, RegexpPrefix) {
+		re, err := regexp.Compile(pattern[len(RegexpPrefix):])
+		if err != nil {
+			return matcher{}, err
+		}
+		return matcher{component: c, regexp: re}, nil
+	}
+
+	p, err := dockerparser.ParsePattern(c.pattern(pattern))
+	if err != nil {
+		return matcher{}, err
+	}
+
+	return matcher{component: c, pattern: p}, nil
+}
+
+func (m matcher) match(reference *dockerparser.Reference) bool {
+	if m.regexp != nil {
+		return m.regexp.MatchString(m.component.of(reference))
+	}
+	return m.pattern.Match(reference)
+}
+
+// matchers is a list of matcher, which matches a reference if any of them does.
+type matchers []matcher
+
+func compileAll(patterns []string, c component) (matchers, error) {
+	list := make(matchers, 0, len(patterns))
+	for _, pattern := range patterns {
+		m, err := compile(pattern, c)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, nil
+}
+
+func (list matchers) match(reference *dockerparser.Reference) bool {
+	for _, m := range list {
+		if m.match(reference) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,274 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package policy enforces declarative rules on image references, such as allowed registries or
+// required digests.
+//
+// A policy can be loaded from JSON:
+//
+// 	{
+// 	  "rules": [
+// 	    { "id": "trusted", "type": "allowed-registries", "patterns": ["docker.io", "*.gcr.io"] },
+// 	    { "id": "pinned", "type": "require-digest", "environments": ["prod"] },
+// 	    { "id": "explicit", "type": "deny-implicit-latest" },
+// 	    { "id": "versioned", "type": "allowed-tags", "patterns": ["regex:^v?[0-9]+\\.[0-9]+\\.[0-9]+$"] },
+// 	    { "id": "official", "type": "denied-repositories", "patterns": ["docker.io/library/*"] }
+// 	  ]
+// 	}
+//
+// Patterns are globs with the syntax of dockerparser.Pattern: in registries, "*" matches any
+// sequence of characters within a host label and "**" matches one or more host labels; in
+// repositories, "*" matches any sequence of characters within a path component and "**" matches zero
+// or more path components; in tags, "*" matches any sequence of characters. Like references,
+// repositories without registry apply to docker.io. Patterns prefixed by "regex:" are regular
+// expressions matched against the registry, the repository or the tag as a string instead.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/docker"
+)
+
+// Type defines the check performed by a rule.
+type Type string
+
+const (
+	// AllowedRegistries requires the registry to match one of the rule's patterns.
+	AllowedRegistries Type = "allowed-registries"
+	// DeniedRegistries forbids registries matching one of the rule's patterns.
+	DeniedRegistries Type = "denied-registries"
+	// AllowedRepositories requires the repository, such as docker.io/library/debian, to match one
+	// of the rule's patterns.
+	AllowedRepositories Type = "allowed-repositories"
+	// DeniedRepositories forbids repositories matching one of the rule's patterns.
+	DeniedRepositories Type = "denied-repositories"
+	// AllowedTags requires the tag to match one of the rule's patterns. References using a digest
+	// are not checked.
+	AllowedTags Type = "allowed-tags"
+	// DeniedTags forbids tags matching one of the rule's patterns.
+	DeniedTags Type = "denied-tags"
+	// RequireDigest requires references to use a digest.
+	RequireDigest Type = "require-digest"
+	// DenyImplicitLatest forbids references without tag nor digest, which use the latest tag.
+	DenyImplicitLatest Type = "deny-implicit-latest"
+	// DenyLatest forbids the latest tag, whether it's explicit or implicit.
+	DenyLatest Type = "deny-latest"
+)
+
+// Rule is a check enforced on references.
+type Rule struct {
+	// ID identifies the rule in violations.
+	ID string `json:"id"`
+	// Type defines the check performed by the rule.
+	Type Type `json:"type"`
+	// Patterns are used by rules matching a component of references.
+	Patterns []string `json:"patterns,omitempty"`
+	// Repositories restricts the rule to repositories matching one of these patterns.
+	// The rule applies to every repository if it's empty.
+	Repositories []string `json:"repositories,omitempty"`
+	// Environments restricts the rule to these environments.
+	// The rule applies in every environment if it's empty.
+	Environments []string `json:"environments,omitempty"`
+	// Message replaces the default message of violations.
+	Message string `json:"message,omitempty"`
+
+	patterns     matchers
+	repositories matchers
+}
+
+// Violation is a rule that a reference doesn't comply with.
+type Violation struct {
+	// RuleID is the ID of the violated rule.
+	RuleID string `json:"rule"`
+	// Reference is the remote identifier of the reference.
+	Reference string `json:"reference"`
+	// Message describes the violation.
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s (%s)", v.Reference, v.Message, v.RuleID)
+}
+
+// Policy is a set of rules.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// New returns a Policy with the given rules, after validating them.
+func New(rules ...Rule) (*Policy, error) {
+
+	policy := &Policy{Rules: make([]Rule, 0, len(rules))}
+
+	for _, rule := range rules {
+		err := rule.compile()
+		if err != nil {
+			return nil, err
+		}
+		policy.Rules = append(policy.Rules, rule)
+	}
+
+	return policy, nil
+}
+
+// Load reads a Policy encoded in JSON from r.
+func Load(r io.Reader) (*Policy, error) {
+
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	policy := Policy{}
+	err := decoder.Decode(&policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(policy.Rules...)
+}
+
+// Evaluate returns every violation of the policy for the given reference in the given environment.
+// Rules restricted to some environments are ignored if environment is empty.
+func (p *Policy) Evaluate(reference *dockerparser.Reference, environment string) []Violation {
+
+	violations := []Violation{}
+
+	for _, rule := range p.Rules {
+		if !rule.applies(reference, environment) {
+			continue
+		}
+		message, ok := rule.check(reference)
+		if ok {
+			continue
+		}
+		if rule.Message != "" {
+			message = rule.Message
+		}
+		violations = append(violations, Violation{
+			RuleID:    rule.ID,
+			Reference: reference.Remote(),
+			Message:   message,
+		})
+	}
+
+	return violations
+}
+
+func (r *Rule) compile() error {
+
+	if r.ID == "" {
+		return fmt.Errorf("rule of type %q has no id", r.Type)
+	}
+
+	switch r.Type {
+	case AllowedRegistries, DeniedRegistries, AllowedRepositories, DeniedRepositories, AllowedTags, DeniedTags:
+		if len(r.Patterns) == 0 {
+			return fmt.Errorf("rule %s: type %q requires patterns", r.ID, r.Type)
+		}
+	case RequireDigest, DenyImplicitLatest, DenyLatest:
+		if len(r.Patterns) != 0 {
+			return fmt.Errorf("rule %s: type %q doesn't use patterns", r.ID, r.Type)
+		}
+	default:
+		return fmt.Errorf("rule %s: unknown type %q", r.ID, r.Type)
+	}
+
+	c := repositoryComponent
+	switch r.Type {
+	case AllowedRegistries, DeniedRegistries:
+		c = registryComponent
+	case AllowedTags, DeniedTags:
+		c = tagComponent
+	}
+
+	var err error
+
+	r.patterns, err = compileAll(r.Patterns, c)
+	if err != nil {
+		return fmt.Errorf("rule %s: %s", r.ID, err)
+	}
+
+	r.repositories, err = compileAll(r.Repositories, repositoryComponent)
+	if err != nil {
+		return fmt.Errorf("rule %s: %s", r.ID, err)
+	}
+
+	return nil
+}
+
+// applies returns true if the rule must be checked for the given reference and environment.
+func (r *Rule) applies(reference *dockerparser.Reference, environment string) bool {
+
+	if len(r.Environments) != 0 {
+		found := false
+		for _, e := range r.Environments {
+			if e == environment {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return len(r.repositories) == 0 || r.repositories.match(reference)
+}
+
+// check returns false, with a message, if the reference violates the rule.
+func (r *Rule) check(reference *dockerparser.Reference) (string, bool) {
+
+	switch r.Type {
+	case AllowedRegistries:
+		return fmt.Sprintf("registry %s is not allowed", reference.Registry()),
+			r.patterns.match(reference)
+
+	case DeniedRegistries:
+		return fmt.Sprintf("registry %s is denied", reference.Registry()),
+			!r.patterns.match(reference)
+
+	case AllowedRepositories:
+		return fmt.Sprintf("repository %s is not allowed", reference.Repository()),
+			r.patterns.match(reference)
+
+	case DeniedRepositories:
+		return fmt.Sprintf("repository %s is denied", reference.Repository()),
+			!r.patterns.match(reference)
+
+	case AllowedTags:
+		return fmt.Sprintf("tag %s is not allowed", reference.Tag()),
+			reference.HasDigest() || r.patterns.match(reference)
+
+	case DeniedTags:
+		return fmt.Sprintf("tag %s is denied", reference.Tag()),
+			reference.HasDigest() || !r.patterns.match(reference)
+
+	case RequireDigest:
+		return "a digest is required", reference.HasDigest()
+
+	case DenyImplicitLatest:
+		return "a tag or a digest is required", !reference.HasImplicitTag()
+
+	case DenyLatest:
+		return "the latest tag is not allowed",
+			reference.HasDigest() || reference.Tag() != docker.DefaultTag
+	}
+
+	return "", true
+}
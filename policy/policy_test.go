@@ -0,0 +1,136 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package policy
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	dockerparser "github.com/novln/docker-parser"
+)
+
+func TestEvaluate(t *testing.T) {
+
+	is := require.New(t)
+
+	policy := load(is)
+
+	is.Empty(evaluate(is, policy, "ghcr.io/novln/app:v1.2.3", "dev"))
+	is.Empty(evaluate(is, policy, "eu.gcr.io/project/app:1.0", "dev"))
+
+	is.Equal([]string{"explicit", "official"}, evaluate(is, policy, "debian", "dev"))
+	is.Equal([]string{"trusted", "pinned"}, evaluate(is, policy, "quay.io/coreos/etcd:v3.4.13", "prod"))
+	is.Equal([]string{"versioned"}, evaluate(is, policy, "ghcr.io/novln/app:latest", ""))
+	is.Empty(evaluate(is, policy, "ghcr.io/novln/app@sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb", "prod"))
+
+}
+
+func TestViolation(t *testing.T) {
+
+	is := require.New(t)
+
+	policy := load(is)
+
+	reference, err := dockerparser.Parse("debian:10")
+	is.NoError(err)
+
+	violations := policy.Evaluate(reference, "")
+	is.Equal([]Violation{{
+		RuleID:    "official",
+		Reference: "docker.io/library/debian:10",
+		Message:   "use our base images",
+	}}, violations)
+	is.Equal("docker.io/library/debian:10: use our base images (official)", violations[0].String())
+
+}
+
+func TestNew(t *testing.T) {
+
+	is := require.New(t)
+
+	policy, err := New(
+		Rule{ID: "latest", Type: DenyLatest},
+		Rule{ID: "registries", Type: DeniedRegistries, Patterns: []string{"regex:^(docker|index\\.docker)\\.io$"}},
+		Rule{ID: "tags", Type: DeniedTags, Patterns: []string{"*-rc*"}},
+		Rule{ID: "internal", Type: DeniedRegistries, Patterns: []string{"**.internal:*"}},
+		Rule{ID: "experimental", Type: DeniedRepositories, Patterns: []string{"**/*/experimental/**"}},
+	)
+	is.NoError(err)
+
+	is.Equal([]string{"latest", "registries"}, evaluate(is, policy, "docker.io/foo/bar", ""))
+	is.Equal([]string{"tags"}, evaluate(is, policy, "quay.io/foo/bar:1.0-rc1", ""))
+	is.Equal([]string{"internal"}, evaluate(is, policy, "eu.registry.internal:5000/foo/bar:1.0", ""))
+	is.Equal([]string{"experimental"}, evaluate(is, policy, "quay.io/foo/experimental/bar:1.0", ""))
+	is.Empty(evaluate(is, policy, "quay.io/foo/bar:1.0", ""))
+	is.Empty(evaluate(is, policy, "internal.example.com:5000/foo/bar:1.0", ""))
+	is.Empty(evaluate(is, policy, "quay.io/experimental/bar:1.0", ""))
+
+}
+
+func TestNewError(t *testing.T) {
+
+	is := require.New(t)
+
+	rules := []Rule{
+		{Type: RequireDigest},
+		{ID: "unknown", Type: "unknown"},
+		{ID: "patterns", Type: AllowedRegistries},
+		{ID: "digest", Type: RequireDigest, Patterns: []string{"*"}},
+		{ID: "regexp", Type: AllowedTags, Patterns: []string{"regex:("}},
+		{ID: "glob", Type: AllowedRepositories, Patterns: []string{"docker.io/foo**"}},
+	}
+
+	for _, rule := range rules {
+		policy, err := New(rule)
+		is.Error(err, "an error was expected for %+v", rule)
+		is.Nil(policy)
+	}
+
+	policy, err := Load(strings.NewReader(`{"rules": [{"id": "foo", "kind": "require-digest"}]}`))
+	is.Error(err)
+	is.Nil(policy)
+
+}
+
+func load(is *require.Assertions) *Policy {
+
+	f, err := os.Open("testdata/policy.json")
+	is.NoError(err)
+	defer f.Close()
+
+	policy, err := Load(f)
+	is.NoError(err)
+	is.NotNil(policy)
+
+	return policy
+}
+
+func evaluate(is *require.Assertions, policy *Policy, remote, environment string) []string {
+
+	reference, err := dockerparser.Parse(remote)
+	is.NoError(err)
+
+	ids := []string{}
+	for _, violation := range policy.Evaluate(reference, environment) {
+		ids = append(ids, violation.RuleID)
+	}
+
+	return ids
+}
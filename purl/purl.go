@@ -0,0 +1,321 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package purl converts references to package URLs, as used by SBOM and vulnerability tools, and
+// back. It supports the docker type (ie: pkg:docker/library/nginx@1.25) and the oci type (ie:
+// pkg:oci/nginx@sha256%3Aabc?repository_url=docker.io/library/nginx&tag=1.25).
+package purl
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	dockerparser "github.com/novln/docker-parser"
+)
+
+// Package URL types supported by conversions.
+const (
+	TypeDocker = "docker"
+	TypeOCI    = "oci"
+)
+
+// Qualifiers used by conversions.
+const (
+	QualifierRepositoryURL = "repository_url"
+	QualifierTag           = "tag"
+)
+
+// dockerHubURLs are the repository URLs designating Docker Hub in docker package URLs.
+var dockerHubURLs = map[string]bool{
+	"docker.io":       true,
+	"index.docker.io": true,
+	"hub.docker.com":  true,
+}
+
+// ErrDigestRequired is returned when an oci package URL is requested for a reference without
+// digest.
+var ErrDigestRequired = errors.New("oci package URLs require a digest")
+
+// URL is a package URL: pkg:type/namespace/name@version?qualifiers#subpath.
+type URL struct {
+	Type       string
+	Namespace  string
+	Name       string
+	Version    string
+	Qualifiers map[string]string
+	Subpath    string
+}
+
+// Parse reads a package URL, and decodes its components.
+func Parse(s string) (*URL, error) {
+
+	u := &URL{Qualifiers: map[string]string{}}
+	remainder := s
+
+	if i := strings.LastIndexByte(remainder, '#'); i != -1 {
+		subpath, err := decodePath(remainder[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid package URL %q: %s", s, err)
+		}
+		u.Subpath, remainder = subpath, remainder[:i]
+	}
+
+	if i := strings.LastIndexByte(remainder, '?'); i != -1 {
+		for _, pair := range strings.Split(remainder[i+1:], "&") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("invalid package URL %q: invalid qualifier %q", s, pair)
+			}
+			value, err := url.PathUnescape(kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid package URL %q: %s", s, err)
+			}
+			if value != "" {
+				u.Qualifiers[strings.ToLower(kv[0])] = value
+			}
+		}
+		remainder = remainder[:i]
+	}
+
+	if !strings.HasPrefix(remainder, "pkg:") {
+		return nil, fmt.Errorf("invalid package URL %q: scheme must be pkg", s)
+	}
+	remainder = strings.TrimLeft(remainder[len("pkg:"):], "/")
+
+	i := strings.IndexByte(remainder, '/')
+	if i < 1 {
+		return nil, fmt.Errorf("invalid package URL %q: type and name are required", s)
+	}
+	u.Type, remainder = strings.ToLower(remainder[:i]), remainder[i+1:]
+
+	if i := strings.LastIndexByte(remainder, '@'); i != -1 {
+		version, err := url.PathUnescape(remainder[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid package URL %q: %s", s, err)
+		}
+		u.Version, remainder = version, remainder[:i]
+	}
+
+	path, err := decodePath(remainder)
+	if err != nil {
+		return nil, fmt.Errorf("invalid package URL %q: %s", s, err)
+	}
+	if path == "" {
+		return nil, fmt.Errorf("invalid package URL %q: name is required", s)
+	}
+	if i := strings.LastIndexByte(path, '/'); i != -1 {
+		u.Namespace, u.Name = path[:i], path[i+1:]
+	} else {
+		u.Name = path
+	}
+
+	return u, nil
+}
+
+// String returns the package URL, with its components percent-encoded and its qualifiers sorted.
+func (u *URL) String() string {
+
+	builder := &strings.Builder{}
+	builder.WriteString("pkg:" + strings.ToLower(u.Type) + "/")
+
+	if u.Namespace != "" {
+		builder.WriteString(encodePath(u.Namespace) + "/")
+	}
+	builder.WriteString(escape(u.Name, false))
+
+	if u.Version != "" {
+		builder.WriteString("@" + escape(u.Version, false))
+	}
+
+	keys := []string{}
+	for key, value := range u.Qualifiers {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		separator := "&"
+		if i == 0 {
+			separator = "?"
+		}
+		builder.WriteString(separator + strings.ToLower(key) + "=" + escape(u.Qualifiers[key], true))
+	}
+
+	if u.Subpath != "" {
+		builder.WriteString("#" + encodePath(u.Subpath))
+	}
+
+	return builder.String()
+}
+
+// Docker returns the docker package URL of the reference: its namespace is the path of the
+// repository before the image name, its version is the tag or the digest, and registries other
+// than Docker Hub are given by the repository_url qualifier.
+// (ie: pkg:docker/library/nginx@1.25 for nginx:1.25)
+func Docker(ref *dockerparser.Reference) *URL {
+
+	components := ref.PathComponents()
+	u := &URL{
+		Type:       TypeDocker,
+		Namespace:  ref.Namespace(),
+		Name:       components[len(components)-1],
+		Version:    ref.Tag(),
+		Qualifiers: map[string]string{},
+	}
+	if !ref.IsDockerHub() {
+		u.Qualifiers[QualifierRepositoryURL] = ref.Registry()
+	}
+
+	return u
+}
+
+// OCI returns the oci package URL of a reference identified by a digest: its name is the image
+// name, its version is the digest, and its repository is given by the repository_url qualifier.
+// The tag qualifier is set if tag isn't empty.
+// (ie: pkg:oci/nginx@sha256%3Aabc?repository_url=docker.io/library/nginx&tag=1.25)
+func OCI(ref *dockerparser.Reference, tag string) (*URL, error) {
+
+	if !ref.HasDigest() {
+		return nil, fmt.Errorf("%s: %s", ref.Remote(), ErrDigestRequired)
+	}
+
+	components := ref.PathComponents()
+	u := &URL{
+		Type:    TypeOCI,
+		Name:    components[len(components)-1],
+		Version: ref.Tag(),
+		Qualifiers: map[string]string{
+			QualifierRepositoryURL: ref.Repository(),
+		},
+	}
+	if tag != "" {
+		u.Qualifiers[QualifierTag] = tag
+	}
+
+	return u, nil
+}
+
+// Reference returns the reference designated by a docker or oci package URL. The tag qualifier of
+// an oci package URL is ignored, since its digest identifies the image. An oci package URL without
+// repository_url designates an image of Docker Hub.
+func (u *URL) Reference() (*dockerparser.Reference, error) {
+
+	switch u.Type {
+	case TypeDocker:
+		return u.docker()
+	case TypeOCI:
+		return u.oci()
+	default:
+		return nil, fmt.Errorf("unsupported package URL type %q", u.Type)
+	}
+}
+
+func (u *URL) docker() (*dockerparser.Reference, error) {
+
+	remote := joinPath(u.Namespace, u.Name)
+	if registry := trimScheme(u.Qualifiers[QualifierRepositoryURL]); registry != "" && !dockerHubURLs[registry] {
+		remote = registry + "/" + remote
+	}
+
+	switch {
+	case strings.Contains(u.Version, ":"):
+		remote += "@" + u.Version
+	case u.Version != "":
+		remote += ":" + u.Version
+	}
+
+	return dockerparser.Parse(remote)
+}
+
+func (u *URL) oci() (*dockerparser.Reference, error) {
+
+	if u.Version == "" {
+		return nil, ErrDigestRequired
+	}
+
+	repository := u.Name
+	if value := trimScheme(u.Qualifiers[QualifierRepositoryURL]); value != "" {
+		if value != u.Name && !strings.HasSuffix(value, "/"+u.Name) {
+			return nil, fmt.Errorf("repository_url %q doesn't end with the name %q", value, u.Name)
+		}
+		repository = value
+	}
+
+	return dockerparser.Parse(repository + "@" + u.Version)
+}
+
+func trimScheme(value string) string {
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "https://"), "http://")
+	return strings.TrimSuffix(value, "/")
+}
+
+func joinPath(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// decodePath returns the decoded path segments joined by slashes, without empty segments.
+func decodePath(path string) (string, error) {
+
+	segments := []string{}
+	for _, segment := range strings.Split(path, "/") {
+		decoded, err := url.PathUnescape(segment)
+		if err != nil {
+			return "", err
+		}
+		if decoded != "" {
+			segments = append(segments, decoded)
+		}
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+// encodePath returns the percent-encoded path segments joined by slashes.
+func encodePath(path string) string {
+
+	segments := strings.Split(path, "/")
+	for i := range segments {
+		segments[i] = escape(segments[i], false)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// escape percent-encodes the characters of s other than letters, digits and "-._~", and slashes
+// if allowed.
+func escape(s string, slash bool) string {
+
+	builder := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && slash:
+			builder.WriteByte(c)
+		default:
+			fmt.Fprintf(builder, "%%%02X", c)
+		}
+	}
+
+	return builder.String()
+}
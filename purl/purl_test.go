@@ -0,0 +1,168 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package purl
+
+import (
+	"testing"
+
+	"github.com/novln/docker-parser/internal/reftest"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testDigest  = "sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb"
+	testEncoded = "sha256%3Abc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb"
+)
+
+func TestParse(t *testing.T) {
+
+	is := require.New(t)
+
+	u, err := Parse("pkg:oci/debian@sha256%3A244fd47e07d10?Repository_URL=ghcr.io/debian&arch=amd64&tag=&empty=#usr/lib%20x/")
+	is.NoError(err)
+	is.Equal(&URL{
+		Type:    "oci",
+		Name:    "debian",
+		Version: "sha256:244fd47e07d10",
+		Qualifiers: map[string]string{
+			"repository_url": "ghcr.io/debian",
+			"arch":           "amd64",
+		},
+		Subpath: "usr/lib x",
+	}, u)
+	is.Equal("pkg:oci/debian@sha256%3A244fd47e07d10?arch=amd64&repository_url=ghcr.io/debian#usr/lib%20x", u.String())
+
+	u, err = Parse("pkg://Docker//smartentry//debian@dc437cc87d10")
+	is.NoError(err)
+	is.Equal("docker", u.Type)
+	is.Equal("smartentry", u.Namespace)
+	is.Equal("debian", u.Name)
+	is.Equal("pkg:docker/smartentry/debian@dc437cc87d10", u.String())
+
+	invalid := []string{
+		"",
+		"docker/library/nginx",
+		"pkg:docker",
+		"pkg:/nginx",
+		"pkg:docker/",
+		"pkg:docker/nginx?tag",
+		"pkg:docker/nginx@%zz",
+		"pkg:docker/ngi%zznx",
+	}
+
+	for _, s := range invalid {
+		u, err := Parse(s)
+		is.Error(err, "an error was expected for %q", s)
+		is.Nil(u)
+	}
+
+}
+
+func TestDocker(t *testing.T) {
+
+	is := require.New(t)
+
+	tests := map[string]string{
+		"nginx:1.25":                            "pkg:docker/library/nginx@1.25",
+		"bitnami/redis":                         "pkg:docker/bitnami/redis@latest",
+		"docker.io/library/nginx@" + testDigest: "pkg:docker/library/nginx@" + testEncoded,
+		"gcr.io/distroless/static:nonroot":      "pkg:docker/distroless/static@nonroot?repository_url=gcr.io",
+		"localhost:5000/team/app/web:1.0":       "pkg:docker/team/app/web@1.0?repository_url=localhost%3A5000",
+		"quay.io/busybox:1":                     "pkg:docker/busybox@1?repository_url=quay.io",
+	}
+
+	for remote, expected := range tests {
+		ref := reftest.Parse(t, remote)
+		is.Equal(expected, Docker(ref).String(), "unexpected package URL for %s", remote)
+
+		u, err := Parse(expected)
+		is.NoError(err)
+		back, err := u.Reference()
+		is.NoError(err, "reference error was not expected for %s", expected)
+		is.Equal(ref.Remote(), back.Remote())
+	}
+
+	others := map[string]string{
+		"pkg:docker/nginx": "docker.io/library/nginx:latest",
+		"pkg:docker/cassandra@latest?repository_url=hub.docker.com":      "docker.io/library/cassandra:latest",
+		"pkg:docker/gcr.io/distroless/static":                            "gcr.io/distroless/static:latest",
+		"pkg:docker/team/app@1.0?repository_url=https://registry.local/": "registry.local/team/app:1.0",
+	}
+
+	for s, expected := range others {
+		u, err := Parse(s)
+		is.NoError(err)
+		ref, err := u.Reference()
+		is.NoError(err, "reference error was not expected for %s", s)
+		is.Equal(expected, ref.Remote())
+	}
+
+}
+
+func TestOCI(t *testing.T) {
+
+	is := require.New(t)
+
+	u, err := OCI(reftest.Parse(t, "nginx@"+testDigest), "1.25")
+	is.NoError(err)
+	is.Equal("pkg:oci/nginx@"+testEncoded+"?repository_url=docker.io/library/nginx&tag=1.25", u.String())
+
+	u, err = OCI(reftest.Parse(t, "localhost:5000/team/app@"+testDigest), "")
+	is.NoError(err)
+	is.Equal("pkg:oci/app@"+testEncoded+"?repository_url=localhost%3A5000/team/app", u.String())
+
+	u, err = Parse(u.String())
+	is.NoError(err)
+	ref, err := u.Reference()
+	is.NoError(err)
+	is.Equal("localhost:5000/team/app@"+testDigest, ref.Remote())
+
+	u, err = OCI(reftest.Parse(t, "nginx:1.25"), "1.25")
+	is.Error(err)
+	is.Contains(err.Error(), ErrDigestRequired.Error())
+	is.Nil(u)
+
+	tests := map[string]string{
+		"pkg:oci/nginx@" + testEncoded + "?repository_url=docker.io/library/nginx&tag=1.25": "docker.io/library/nginx@" + testDigest,
+		"pkg:oci/debian@" + testEncoded + "?repository_url=ghcr.io/debian":                  "ghcr.io/debian@" + testDigest,
+		"pkg:oci/debian@" + testEncoded:                                                     "docker.io/library/debian@" + testDigest,
+	}
+
+	for s, expected := range tests {
+		u, err := Parse(s)
+		is.NoError(err)
+		ref, err := u.Reference()
+		is.NoError(err, "reference error was not expected for %s", s)
+		is.Equal(expected, ref.Remote())
+	}
+
+	invalid := []string{
+		"pkg:oci/nginx?repository_url=docker.io/library/nginx",
+		"pkg:oci/nginx@" + testEncoded + "?repository_url=docker.io/library/debian",
+		"pkg:oci/nginx@1.25",
+		"pkg:npm/left-pad@1.3.0",
+	}
+
+	for _, s := range invalid {
+		u, err := Parse(s)
+		is.NoError(err)
+		ref, err := u.Reference()
+		is.Error(err, "an error was expected for %s", s)
+		is.Nil(ref)
+	}
+
+}
@@ -0,0 +1,167 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package referrers implements the referrers tag schema of the OCI distribution specification,
+// used with registries without the referrers API: the referrers of a manifest are listed by an
+// index pushed at a fallback tag derived from the digest of the manifest. (ie: sha256-<hex>)
+package referrers
+
+import (
+	"fmt"
+	"strings"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/distribution/digest"
+	"github.com/novln/docker-parser/manifest"
+)
+
+// Limits of the algorithm and the encoded digest in fallback tags, so that tags stay under the
+// 128 characters allowed by reference.TagRegexp.
+const (
+	maxAlgorithm = 32
+	maxEncoded   = 64
+)
+
+// FallbackTag returns the fallback tag listing the referrers of the given digest: <alg>-<encoded>,
+// with the algorithm truncated to 32 characters, the encoded digest truncated to 64 characters, and
+// the characters invalid in tags replaced by dashes. Truncated tags of different digests might
+// collide.
+func FallbackTag(d digest.Digest) string {
+
+	parts := strings.SplitN(d.String(), ":", 2)
+	algorithm, encoded := parts[0], ""
+	if len(parts) == 2 {
+		encoded = parts[1]
+	}
+
+	return sanitize(truncate(algorithm, maxAlgorithm)) + "-" + sanitize(truncate(encoded, maxEncoded))
+}
+
+// ParseFallbackTag returns the digest encoded by a fallback tag, or false if the tag isn't one or
+// was truncated, such as the fallback tags of sha512 digests. Use MatchFallbackTag to check those.
+func ParseFallbackTag(tag string) (digest.Digest, bool) {
+
+	i := strings.IndexByte(tag, '-')
+	if i == -1 {
+		return "", false
+	}
+
+	d := digest.Digest(tag[:i] + ":" + tag[i+1:])
+	if d.Validate() != nil {
+		return "", false
+	}
+
+	return d, true
+}
+
+// MatchFallbackTag returns true if the tag is the fallback tag of the digest.
+func MatchFallbackTag(tag string, d digest.Digest) bool {
+	return tag == FallbackTag(d)
+}
+
+// FallbackReference returns the reference of the fallback tag listing the referrers of the given
+// reference, which must have a digest.
+func FallbackReference(subject *dockerparser.Reference) (*dockerparser.Reference, error) {
+
+	if !subject.HasDigest() {
+		return nil, fmt.Errorf("%s: the referrers of a reference require its digest", subject.Remote())
+	}
+
+	return subject.WithTag(FallbackTag(digest.Digest(subject.Tag())))
+}
+
+// Descriptor returns the descriptor of a manifest as listed in a referrers index: with its
+// artifact type, or the media type of its config if it has none, and its annotations.
+func Descriptor(m *manifest.Manifest) (manifest.Descriptor, error) {
+
+	descriptor, err := manifest.Describe(m)
+	if err != nil {
+		return manifest.Descriptor{}, err
+	}
+
+	if descriptor.ArtifactType == "" {
+		descriptor.ArtifactType = m.Config.MediaType
+	}
+	descriptor.Annotations = m.Annotations
+
+	return descriptor, nil
+}
+
+// NewIndex returns a referrers index listing the given descriptors.
+func NewIndex(descriptors ...manifest.Descriptor) *manifest.Index {
+	return &manifest.Index{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeOCIIndex,
+		Manifests:     append([]manifest.Descriptor{}, descriptors...),
+	}
+}
+
+// Add returns a copy of the referrers index with the given descriptor, which replaces the one with
+// the same digest, if any.
+func Add(index *manifest.Index, descriptor manifest.Descriptor) *manifest.Index {
+
+	updated := Remove(index, descriptor.Digest)
+	updated.Manifests = append(updated.Manifests, descriptor)
+
+	return updated
+}
+
+// Remove returns a copy of the referrers index without the descriptor of the given digest.
+func Remove(index *manifest.Index, d digest.Digest) *manifest.Index {
+
+	updated := *index
+	updated.Manifests = []manifest.Descriptor{}
+	for _, descriptor := range index.Manifests {
+		if descriptor.Digest != d {
+			updated.Manifests = append(updated.Manifests, descriptor)
+		}
+	}
+
+	return &updated
+}
+
+// Filter returns the descriptors of the referrers index with the given artifact type.
+func Filter(index *manifest.Index, artifactType string) []manifest.Descriptor {
+
+	descriptors := []manifest.Descriptor{}
+	for _, descriptor := range index.Manifests {
+		if descriptor.ArtifactType == artifactType {
+			descriptors = append(descriptors, descriptor)
+		}
+	}
+
+	return descriptors
+}
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
+
+// sanitize replaces the characters other than letters, digits, dots, underscores and dashes with
+// dashes.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		default:
+			return '-'
+		}
+	}, s)
+}
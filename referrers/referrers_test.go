@@ -0,0 +1,153 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package referrers
+
+import (
+	"strings"
+	"testing"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/distribution/digest"
+	"github.com/novln/docker-parser/distribution/reference"
+	"github.com/novln/docker-parser/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testHex    = "bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb"
+	testDigest = "sha256:" + testHex
+)
+
+func TestFallbackTag(t *testing.T) {
+
+	is := require.New(t)
+
+	sha512 := digest.Digest("sha512:" + strings.Repeat("ab", 64))
+	long := digest.Digest(strings.Repeat("x", 40) + "+b64:" + strings.Repeat("c", 100))
+
+	tests := map[digest.Digest]string{
+		testDigest:        "sha256-" + testHex,
+		sha512:            "sha512-" + strings.Repeat("ab", 32),
+		long:              strings.Repeat("x", 32) + "-" + strings.Repeat("c", 64),
+		"custom+b64:a/b=": "custom-b64-a-b-",
+	}
+
+	for d, expected := range tests {
+		tag := FallbackTag(d)
+		is.Equal(expected, tag, "unexpected tag for %s", d)
+		is.True(reference.TagRegexp.MatchString(tag))
+		is.True(MatchFallbackTag(tag, d))
+	}
+
+	d, ok := ParseFallbackTag("sha256-" + testHex)
+	is.True(ok)
+	is.Equal(digest.Digest(testDigest), d)
+
+	for _, tag := range []string{FallbackTag(sha512), "latest", "sha256-" + testHex[:10], "v1.0-rc1"} {
+		d, ok := ParseFallbackTag(tag)
+		is.False(ok, "no digest was expected for %s", tag)
+		is.Empty(d)
+	}
+
+	is.False(MatchFallbackTag("sha256-"+testHex, sha512))
+
+}
+
+func TestFallbackReference(t *testing.T) {
+
+	is := require.New(t)
+
+	subject, err := dockerparser.Parse("ghcr.io/team/app@" + testDigest)
+	is.NoError(err)
+
+	fallback, err := FallbackReference(subject)
+	is.NoError(err)
+	is.Equal("ghcr.io/team/app:sha256-"+testHex, fallback.Remote())
+
+	subject, err = dockerparser.Parse("ghcr.io/team/app:1.0")
+	is.NoError(err)
+
+	fallback, err = FallbackReference(subject)
+	is.Error(err)
+	is.Nil(fallback)
+
+}
+
+func TestIndex(t *testing.T) {
+
+	is := require.New(t)
+
+	subject := manifest.DescriptorOf(manifest.MediaTypeOCIManifest, []byte("subject"))
+
+	signature := &manifest.Manifest{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeOCIManifest,
+		ArtifactType:  "application/vnd.dev.cosign.artifact.sig.v1+json",
+		Config:        manifest.DescriptorOf(manifest.MediaTypeOCIEmpty, []byte("{}")),
+		Layers:        []manifest.Descriptor{manifest.DescriptorOf("application/vnd.dev.cosign.simplesigning.v1+json", []byte("sig"))},
+		Subject:       &subject,
+		Annotations:   map[string]string{"org.opencontainers.image.created": "2024-01-01T00:00:00Z"},
+	}
+	sbom := &manifest.Manifest{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeOCIManifest,
+		Config:        manifest.DescriptorOf("application/spdx+json", []byte("{}")),
+		Layers:        []manifest.Descriptor{},
+		Subject:       &subject,
+	}
+
+	first, err := Descriptor(signature)
+	is.NoError(err)
+	is.Equal(signature.ArtifactType, first.ArtifactType)
+	is.Equal(signature.Annotations, first.Annotations)
+
+	second, err := Descriptor(sbom)
+	is.NoError(err)
+	is.Equal("application/spdx+json", second.ArtifactType)
+
+	_, err = Descriptor(&manifest.Manifest{SchemaVersion: 2})
+	is.Error(err)
+
+	index := NewIndex()
+	is.NoError(index.Validate())
+	is.Empty(index.Manifests)
+
+	index = Add(index, first)
+	index = Add(index, second)
+	is.Len(index.Manifests, 2)
+
+	updated := first
+	updated.Annotations = map[string]string{"updated": "true"}
+	replaced := Add(index, updated)
+	is.Len(replaced.Manifests, 2)
+	is.Equal(updated, replaced.Manifests[1])
+	is.Equal(first, index.Manifests[0])
+
+	is.Equal([]manifest.Descriptor{second}, Filter(index, "application/spdx+json"))
+	is.Empty(Filter(index, "application/vnd.example"))
+
+	removed := Remove(index, second.Digest)
+	is.Equal([]manifest.Descriptor{first}, removed.Manifests)
+	is.Len(index.Manifests, 2)
+
+	body, err := manifest.Marshal(index)
+	is.NoError(err)
+	payload, err := manifest.Parse(manifest.MediaTypeOCIIndex, body)
+	is.NoError(err)
+	is.Equal(index, payload)
+
+}
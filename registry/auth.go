@@ -0,0 +1,439 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/docker"
+)
+
+// Credentials authenticate a client on a registry.
+type Credentials struct {
+	// Username and Password are used for basic authentication, and to request tokens.
+	Username string
+	Password string
+	// IdentityToken is an OAuth2 refresh token used to request tokens instead of the password.
+	IdentityToken string
+}
+
+// CredentialsFunc returns the credentials of the given registry, as host[:port], or nil to access
+// it anonymously. The context is the one of the request requiring the credentials.
+type CredentialsFunc func(ctx context.Context, registry string) (*Credentials, error)
+
+// Challenge is an authentication challenge of a WWW-Authenticate header.
+// (ie: Bearer realm="https://auth.docker.io/token",service="registry.docker.io")
+type Challenge struct {
+	// Scheme is the authentication scheme, in lower case. (ie: bearer, basic)
+	Scheme string
+	// Parameters are the parameters of the challenge, with lower case names.
+	Parameters map[string]string
+}
+
+// minTokenLifetime is the lifetime of tokens without expiration, or with a shorter one, as required
+// by the token authentication specification.
+const minTokenLifetime = 60 * time.Second
+
+// Transport is an http.RoundTripper implementing the authentication flows of registries.
+//
+// When a registry answers a request with a 401 status code, the transport reads the challenge of
+// its WWW-Authenticate header. For the Bearer scheme, it requests a token from the realm for the
+// scope of the request, such as "repository:team/app:pull", and retries the request with it. For
+// the Basic scheme, it retries the request with the credentials of the registry. Challenges and
+// tokens are cached until they expire, so that following requests are authenticated directly.
+type Transport struct {
+	// Base is the transport used for requests. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+	// Credentials returns the credentials of a registry. If nil, registries are accessed
+	// anonymously.
+	Credentials CredentialsFunc
+
+	mutex      sync.Mutex
+	challenges map[string]Challenge
+	tokens     map[string]token
+}
+
+type token struct {
+	value   string
+	expires time.Time
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	if req.Header.Get("Authorization") != "" {
+		return t.base().RoundTrip(req)
+	}
+
+	host := req.URL.Host
+	scope := scopeOf(req.URL.Path)
+
+	t.mutex.Lock()
+	challenge, known := t.challenges[host]
+	t.mutex.Unlock()
+
+	var res *http.Response
+	var err error
+
+	if known {
+		var authorization string
+		if authorization, err = t.authorize(req, challenge, scope); err != nil {
+			return nil, err
+		}
+		if authorization != "" {
+			res, err = t.base().RoundTrip(withAuthorization(req, authorization))
+			if err != nil || res.StatusCode != http.StatusUnauthorized {
+				return res, err
+			}
+			// The token may have been revoked: request a new one.
+			t.forget(challenge, scope)
+		}
+	}
+
+	if res == nil {
+		res, err = t.base().RoundTrip(req)
+		if err != nil || res.StatusCode != http.StatusUnauthorized {
+			return res, err
+		}
+	}
+
+	challenge, ok := preferredChallenge(ParseChallenges(res.Header.Values("WWW-Authenticate")))
+	if !ok || (req.Body != nil && req.GetBody == nil) {
+		return res, nil
+	}
+	if s := challenge.Parameters["scope"]; s != "" {
+		scope = s
+	}
+
+	t.mutex.Lock()
+	if t.challenges == nil {
+		t.challenges = map[string]Challenge{}
+	}
+	t.challenges[host] = challenge
+	t.mutex.Unlock()
+
+	authorization, err := t.authorize(req, challenge, scope)
+	if err != nil {
+		_ = drain(res)
+		return nil, err
+	}
+	if authorization == "" {
+		return res, nil
+	}
+	_ = drain(res)
+
+	retry := withAuthorization(req, authorization)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+
+	return t.base().RoundTrip(retry)
+}
+
+// authorize returns the Authorization header answering the challenge, or an empty string if the
+// request must be anonymous.
+func (t *Transport) authorize(req *http.Request, challenge Challenge, scope string) (string, error) {
+
+	credentials, err := t.credentials(req.Context(), req.URL.Host)
+	if err != nil {
+		return "", err
+	}
+
+	switch challenge.Scheme {
+	case "basic":
+		if credentials == nil || credentials.Username == "" {
+			return "", nil
+		}
+		r := &http.Request{Header: http.Header{}}
+		r.SetBasicAuth(credentials.Username, credentials.Password)
+		return r.Header.Get("Authorization"), nil
+
+	case "bearer":
+		value, err := t.token(req, challenge, scope, credentials)
+		if err != nil || value == "" {
+			return "", err
+		}
+		return "Bearer " + value, nil
+	}
+
+	return "", nil
+}
+
+// token returns a token for the scope, from the cache or from the realm of the challenge.
+func (t *Transport) token(req *http.Request, challenge Challenge, scope string, credentials *Credentials) (string, error) {
+
+	realm := challenge.Parameters["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("bearer challenge of %s has no realm", req.URL.Host)
+	}
+	service := challenge.Parameters["service"]
+	key := realm + " " + service + " " + scope
+
+	t.mutex.Lock()
+	cached, ok := t.tokens[key]
+	t.mutex.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("invalid realm %q: %s", realm, err)
+	}
+	params := url.Values{}
+	if service != "" {
+		params.Set("service", service)
+	}
+	if scope != "" {
+		params.Set("scope", scope)
+	}
+
+	var tokenReq *http.Request
+	if credentials != nil && credentials.IdentityToken != "" {
+		params.Set("grant_type", "refresh_token")
+		params.Set("refresh_token", credentials.IdentityToken)
+		params.Set("client_id", "docker-parser")
+		tokenReq, err = http.NewRequest(http.MethodPost, u.String(), strings.NewReader(params.Encode()))
+		if err != nil {
+			return "", err
+		}
+		tokenReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		query := u.Query()
+		for name, values := range params {
+			query[name] = values
+		}
+		u.RawQuery = query.Encode()
+		tokenReq, err = http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		if credentials != nil && credentials.Username != "" {
+			tokenReq.SetBasicAuth(credentials.Username, credentials.Password)
+		}
+	}
+
+	res, err := t.base().RoundTrip(tokenReq.WithContext(req.Context()))
+	if err != nil {
+		return "", err
+	}
+	defer drain(res)
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token server %s responded with status %d", u.Host, res.StatusCode)
+	}
+
+	body := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{}
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid token response from %s: %s", u.Host, err)
+	}
+
+	value := body.Token
+	if value == "" {
+		value = body.AccessToken
+	}
+	if value == "" {
+		return "", fmt.Errorf("token server %s returned no token", u.Host)
+	}
+
+	lifetime := time.Duration(body.ExpiresIn) * time.Second
+	if lifetime < minTokenLifetime {
+		lifetime = minTokenLifetime
+	}
+	// The lifetime starts when the token is received rather than at its issued_at time, which
+	// may be skewed by the clock of the token server.
+	t.mutex.Lock()
+	if t.tokens == nil {
+		t.tokens = map[string]token{}
+	}
+	t.tokens[key] = token{value: value, expires: time.Now().Add(lifetime)}
+	t.mutex.Unlock()
+
+	return value, nil
+}
+
+// forget removes the cached token of the challenge for the scope.
+func (t *Transport) forget(challenge Challenge, scope string) {
+	t.mutex.Lock()
+	delete(t.tokens, challenge.Parameters["realm"]+" "+challenge.Parameters["service"]+" "+scope)
+	t.mutex.Unlock()
+}
+
+func (t *Transport) credentials(ctx context.Context, host string) (*Credentials, error) {
+
+	if t.Credentials == nil {
+		return nil, nil
+	}
+	if host == DockerHubEndpoint {
+		host = docker.DefaultHostname
+	}
+
+	return t.Credentials(ctx, host)
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// Scope returns the token scope granting the given actions on the repository of the reference.
+// (ie: repository:team/app:pull,push) Without actions, it grants "pull".
+func Scope(ref *dockerparser.Reference, actions ...string) string {
+	if len(actions) == 0 {
+		actions = []string{"pull"}
+	}
+	return "repository:" + ref.ShortName() + ":" + strings.Join(actions, ",")
+}
+
+// scopeOf returns the pull scope of a request to the given API path, or an empty string if it
+// isn't about a repository.
+func scopeOf(path string) string {
+
+	path = strings.TrimPrefix(path, "/v2/")
+	for _, endpoint := range []string{"/manifests/", "/blobs/", "/tags/list", "/referrers/"} {
+		if i := strings.LastIndex(path, endpoint); i > 0 {
+			return "repository:" + path[:i] + ":pull"
+		}
+	}
+
+	return ""
+}
+
+// preferredChallenge returns the bearer challenge if there is one, the basic one otherwise.
+func preferredChallenge(challenges []Challenge) (Challenge, bool) {
+
+	var basic *Challenge
+
+	for i := range challenges {
+		switch challenges[i].Scheme {
+		case "bearer":
+			return challenges[i], true
+		case "basic":
+			if basic == nil {
+				basic = &challenges[i]
+			}
+		}
+	}
+
+	if basic == nil {
+		return Challenge{}, false
+	}
+	return *basic, true
+}
+
+// withAuthorization returns a copy of the request with the given Authorization header.
+func withAuthorization(req *http.Request, authorization string) *http.Request {
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", authorization)
+	return r
+}
+
+// ParseChallenges returns the challenges of WWW-Authenticate headers. Malformed challenges are
+// ignored.
+func ParseChallenges(headers []string) []Challenge {
+
+	challenges := []Challenge{}
+
+	for _, header := range headers {
+		s := header
+		for {
+			s = strings.TrimLeft(s, " \t,")
+			if s == "" {
+				break
+			}
+
+			var scheme string
+			scheme, s = token68(s)
+			if scheme == "" {
+				break
+			}
+			challenge := Challenge{Scheme: strings.ToLower(scheme), Parameters: map[string]string{}}
+
+			for {
+				rest := strings.TrimLeft(s, " \t,")
+				name, after := token68(rest)
+				after = strings.TrimLeft(after, " \t")
+				if name == "" || !strings.HasPrefix(after, "=") {
+					// Not a parameter, but the scheme of the next challenge.
+					s = rest
+					break
+				}
+				after = strings.TrimLeft(after[1:], " \t")
+
+				var value string
+				if strings.HasPrefix(after, `"`) {
+					value, s = quoted(after)
+				} else {
+					value, s = token68(after)
+				}
+				challenge.Parameters[strings.ToLower(name)] = value
+			}
+
+			challenges = append(challenges, challenge)
+		}
+	}
+
+	return challenges
+}
+
+// token68 splits s after the token it starts with.
+func token68(s string) (string, string) {
+	i := strings.IndexAny(s, " \t,=\"")
+	if i == -1 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// quoted splits s after the quoted string it starts with, and returns its unescaped value.
+func quoted(s string) (string, string) {
+
+	value := []byte{}
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				value = append(value, s[i])
+			}
+		case '"':
+			return string(value), s[i+1:]
+		default:
+			value = append(value, s[i])
+		}
+	}
+
+	return string(value), ""
+}
@@ -0,0 +1,449 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package registry is a client for the read operations of the OCI distribution specification:
+// checking the API version, fetching manifests, listing tags and downloading blobs of an image
+// identified by a reference.
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/distribution/digest"
+	"github.com/novln/docker-parser/docker"
+	"github.com/novln/docker-parser/manifest"
+)
+
+// Media types of the manifests a client accepts.
+const (
+	MediaTypeOCIManifest    = manifest.MediaTypeOCIManifest
+	MediaTypeOCIIndex       = manifest.MediaTypeOCIIndex
+	MediaTypeDockerManifest = manifest.MediaTypeDockerManifest
+	MediaTypeDockerList     = manifest.MediaTypeDockerList
+	MediaTypeDockerSchema1  = manifest.MediaTypeDockerSchema1
+)
+
+// headerDockerContentDigest is the header in which registries return the digest of a manifest.
+const headerDockerContentDigest = "Docker-Content-Digest"
+
+// DefaultAccept is the list of manifest media types sent by a client without Accept.
+var DefaultAccept = []string{
+	MediaTypeOCIIndex,
+	MediaTypeOCIManifest,
+	MediaTypeDockerList,
+	MediaTypeDockerManifest,
+}
+
+// DockerHubEndpoint is the host serving the registry API of docker.io.
+const DockerHubEndpoint = "registry-1.docker.io"
+
+// MaxManifestSize is the maximum size of a manifest a client reads.
+const MaxManifestSize = 4 << 20
+
+// DefaultClient is the client used by package-level functions.
+var DefaultClient = &Client{}
+
+// Client talks to registries implementing the OCI distribution specification.
+//
+// Registries are accessed with HTTPS, except loopback addresses and the registries listed in
+// Insecure, which are accessed with plain HTTP, like the Docker daemon does.
+type Client struct {
+	// HTTPClient is the client used for requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// Insecure lists the registries, as host[:port], accessed with plain HTTP.
+	Insecure []string
+	// Accept lists the manifest media types sent in the Accept header. If empty, DefaultAccept
+	// is used.
+	Accept []string
+}
+
+// Descriptor describes a manifest returned by a registry.
+type Descriptor struct {
+	// MediaType is the media type of the manifest.
+	MediaType string
+	// Digest is the digest of the manifest, if the registry returned it.
+	Digest digest.Digest
+	// Size is the size of the manifest in bytes, or -1 if unknown.
+	Size int64
+}
+
+// Manifest is a manifest returned by a registry.
+type Manifest struct {
+	Descriptor
+	// Body is the content of the manifest.
+	Body []byte
+}
+
+// Error is returned when a registry answers with an unexpected status code.
+type Error struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Errors are the errors described in the response body, if any.
+	Errors []ErrorDetail `json:"errors"`
+}
+
+// ErrorDetail is an error described in the body of a registry response.
+type ErrorDetail struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Detail  json.RawMessage `json:"detail,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Errors) == 0 {
+		return fmt.Sprintf("registry responded with status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	details := make([]string, 0, len(e.Errors))
+	for _, detail := range e.Errors {
+		details = append(details, strings.ToLower(detail.Code)+": "+detail.Message)
+	}
+	return fmt.Sprintf("registry responded with status %d: %s", e.StatusCode, strings.Join(details, ", "))
+}
+
+// IsNotFound returns true if the error is a registry response with a 404 status code.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// Ping checks that the registry implements the distribution API, by requesting "/v2/".
+func (c *Client) Ping(ctx context.Context, registry string) error {
+
+	res, err := c.do(ctx, http.MethodGet, c.url(registry, "/v2/"), "")
+	if err != nil {
+		return err
+	}
+
+	return drain(res)
+}
+
+// HeadManifest returns the descriptor of the manifest identified by the reference, without
+// downloading it.
+func (c *Client) HeadManifest(ctx context.Context, ref *dockerparser.Reference) (*Descriptor, error) {
+
+	res, err := c.do(ctx, http.MethodHead, c.manifestURL(ref), c.acceptHeader())
+	if err != nil {
+		return nil, err
+	}
+	defer drain(res)
+
+	return descriptor(res)
+}
+
+// GetManifest returns the manifest identified by the reference. Its digest is computed from its
+// content if the registry doesn't return it, and verified otherwise.
+func (c *Client) GetManifest(ctx context.Context, ref *dockerparser.Reference) (*Manifest, error) {
+
+	res, err := c.do(ctx, http.MethodGet, c.manifestURL(ref), c.acceptHeader())
+	if err != nil {
+		return nil, err
+	}
+	defer drain(res)
+
+	desc, err := descriptor(res)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, MaxManifestSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > MaxManifestSize {
+		return nil, fmt.Errorf("manifest of %s exceeds %d bytes", ref.Remote(), MaxManifestSize)
+	}
+
+	if desc.Size < 0 {
+		desc.Size = int64(len(body))
+	}
+	if desc.Size != int64(len(body)) {
+		return nil, fmt.Errorf("manifest of %s has %d bytes instead of %d", ref.Remote(), len(body), desc.Size)
+	}
+
+	if desc.Digest == "" {
+		desc.Digest = digest.FromBytes(body)
+	} else if actual := desc.Digest.Algorithm().FromBytes(body); actual != desc.Digest {
+		return nil, fmt.Errorf("manifest of %s has digest %s instead of %s", ref.Remote(), actual, desc.Digest)
+	}
+	if ref.HasDigest() {
+		expected := digest.Digest(ref.Tag())
+		if actual := expected.Algorithm().FromBytes(body); actual != expected {
+			return nil, fmt.Errorf("manifest of %s has digest %s", ref.Remote(), actual)
+		}
+	}
+
+	return &Manifest{Descriptor: *desc, Body: body}, nil
+}
+
+// Tags returns the tags of the repository of the reference, following the pagination of the
+// registry.
+func (c *Client) Tags(ctx context.Context, ref *dockerparser.Reference) ([]string, error) {
+
+	tags := []string{}
+	next := c.url(ref.Registry(), "/v2/"+ref.ShortName()+"/tags/list")
+
+	for next != "" {
+		res, err := c.do(ctx, http.MethodGet, next, "")
+		if err != nil {
+			return nil, err
+		}
+
+		page := struct {
+			Tags []string `json:"tags"`
+		}{}
+		err = json.NewDecoder(res.Body).Decode(&page)
+		drain(res)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag list of %s: %s", ref.Repository(), err)
+		}
+		tags = append(tags, page.Tags...)
+
+		next, err = nextLink(res.Request.URL, res.Header.Get("Link"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+// GetBlob returns the content of the blob identified by the digest in the repository of the
+// reference. The content is verified while it's read: reading it returns an error at the end if it
+// doesn't match the digest.
+func (c *Client) GetBlob(ctx context.Context, ref *dockerparser.Reference, d digest.Digest) (io.ReadCloser, error) {
+
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+
+	res, err := c.do(ctx, http.MethodGet, c.url(ref.Registry(), "/v2/"+ref.ShortName()+"/blobs/"+d.String()), "")
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm := d.Algorithm()
+
+	return &verifier{body: res.Body, digest: d, hash: algorithm.Hash(), algorithm: algorithm}, nil
+}
+
+// verifier checks that the content of a blob matches its digest once it's completely read.
+type verifier struct {
+	body      io.ReadCloser
+	digest    digest.Digest
+	algorithm digest.Algorithm
+	hash      hash.Hash
+}
+
+func (v *verifier) Read(p []byte) (int, error) {
+	n, err := v.body.Read(p)
+	v.hash.Write(p[:n])
+	if err == io.EOF {
+		if actual := digest.NewDigest(v.algorithm, v.hash); actual != v.digest {
+			return n, fmt.Errorf("blob content has digest %s instead of %s", actual, v.digest)
+		}
+	}
+	return n, err
+}
+
+func (v *verifier) Close() error {
+	return v.body.Close()
+}
+
+// Ping checks that the registry implements the distribution API, using the DefaultClient.
+func Ping(ctx context.Context, registry string) error {
+	return DefaultClient.Ping(ctx, registry)
+}
+
+// HeadManifest returns the descriptor of the manifest identified by the reference, using the
+// DefaultClient.
+func HeadManifest(ctx context.Context, ref *dockerparser.Reference) (*Descriptor, error) {
+	return DefaultClient.HeadManifest(ctx, ref)
+}
+
+// GetManifest returns the manifest identified by the reference, using the DefaultClient.
+func GetManifest(ctx context.Context, ref *dockerparser.Reference) (*Manifest, error) {
+	return DefaultClient.GetManifest(ctx, ref)
+}
+
+// Tags returns the tags of the repository of the reference, using the DefaultClient.
+func Tags(ctx context.Context, ref *dockerparser.Reference) ([]string, error) {
+	return DefaultClient.Tags(ctx, ref)
+}
+
+// GetBlob returns the content of the blob identified by the digest in the repository of the
+// reference, using the DefaultClient.
+func GetBlob(ctx context.Context, ref *dockerparser.Reference, d digest.Digest) (io.ReadCloser, error) {
+	return DefaultClient.GetBlob(ctx, ref, d)
+}
+
+func (c *Client) do(ctx context.Context, method, u, accept string) (*http.Response, error) {
+
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer drain(res)
+		e := &Error{StatusCode: res.StatusCode}
+		if method != http.MethodHead {
+			_ = json.NewDecoder(io.LimitReader(res.Body, 1<<16)).Decode(e)
+		}
+		return nil, e
+	}
+
+	return res, nil
+}
+
+func (c *Client) acceptHeader() string {
+	if len(c.Accept) == 0 {
+		return strings.Join(DefaultAccept, ", ")
+	}
+	return strings.Join(c.Accept, ", ")
+}
+
+func (c *Client) manifestURL(ref *dockerparser.Reference) string {
+	return c.url(ref.Registry(), "/v2/"+ref.ShortName()+"/manifests/"+ref.Tag())
+}
+
+// url returns the URL of the given path on the registry.
+func (c *Client) url(registry, path string) string {
+
+	host := registry
+	if host == docker.DefaultHostname || host == docker.LegacyDefaultHostname {
+		host = DockerHubEndpoint
+	}
+
+	scheme := "https"
+	if c.isInsecure(registry) {
+		scheme = "http"
+	}
+
+	return scheme + "://" + host + path
+}
+
+func (c *Client) isInsecure(registry string) bool {
+
+	for _, insecure := range c.Insecure {
+		if insecure == registry {
+			return true
+		}
+	}
+
+	host := registry
+	if h, _, err := net.SplitHostPort(registry); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// descriptor returns the descriptor of the manifest in the response.
+func descriptor(res *http.Response) (*Descriptor, error) {
+
+	desc := &Descriptor{
+		MediaType: res.Header.Get("Content-Type"),
+		Size:      -1,
+	}
+	if i := strings.IndexByte(desc.MediaType, ';'); i != -1 {
+		desc.MediaType = strings.TrimSpace(desc.MediaType[:i])
+	}
+
+	if s := res.Header.Get(headerDockerContentDigest); s != "" {
+		d, err := digest.ParseDigest(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s header %q: %s", headerDockerContentDigest, s, err)
+		}
+		desc.Digest = d
+	}
+
+	if s := res.Header.Get("Content-Length"); s != "" {
+		size, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid Content-Length header %q", s)
+		}
+		desc.Size = size
+	}
+
+	return desc, nil
+}
+
+// nextLink returns the URL of the next page given by a Link header, such as
+// `</v2/foo/tags/list?n=10&last=b>; rel="next"`, or an empty string if there is none.
+func nextLink(base *url.URL, header string) (string, error) {
+
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+
+		next := false
+		for _, param := range parts[1:] {
+			param = strings.Replace(strings.TrimSpace(param), " ", "", -1)
+			if param == `rel="next"` || param == "rel=next" {
+				next = true
+			}
+		}
+		if !next {
+			continue
+		}
+
+		u, err := base.Parse(target[1 : len(target)-1])
+		if err != nil {
+			return "", fmt.Errorf("invalid Link header %q: %s", header, err)
+		}
+		return u.String(), nil
+	}
+
+	return "", nil
+}
+
+// drain discards the rest of the response body and closes it, so that the connection can be
+// reused.
+func drain(res *http.Response) error {
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+	return res.Body.Close()
+}
@@ -0,0 +1,657 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/novln/docker-parser/distribution/digest"
+	"github.com/novln/docker-parser/internal/reftest"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeManifest is a manifest served by a fakeRegistry.
+type fakeManifest struct {
+	mediaType string
+	body      []byte
+}
+
+// fakeRegistry is a stand-in registry serving manifests, tags and blobs from memory.
+type fakeRegistry struct {
+	// manifests maps "name:tag" and "name@digest" to manifests.
+	manifests map[string]fakeManifest
+	// blobs maps digests to their content.
+	blobs map[digest.Digest][]byte
+	// pageSize is the maximum number of tags per page, if not zero.
+	pageSize int
+	// hideDigest omits the Docker-Content-Digest header.
+	hideDigest bool
+	// denyHead rejects HEAD requests of manifests.
+	denyHead bool
+	// requests records the requests received, as "METHOD path".
+	requests []string
+	// accepts records the Accept header of the requests received.
+	accepts []string
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{
+		manifests: map[string]fakeManifest{},
+		blobs:     map[digest.Digest][]byte{},
+	}
+}
+
+// push adds a manifest for the given tag of the given repository, and returns its digest.
+func (f *fakeRegistry) push(name, tag, mediaType, body string) digest.Digest {
+	d := digest.FromBytes([]byte(body))
+	m := fakeManifest{mediaType: mediaType, body: []byte(body)}
+	f.manifests[name+":"+tag] = m
+	f.manifests[name+"@"+d.String()] = m
+	return d
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	f.requests = append(f.requests, r.Method+" "+r.URL.RequestURI())
+	f.accepts = append(f.accepts, r.Header.Get("Accept"))
+
+	path := r.URL.Path
+	switch {
+	case path == "/v2/":
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		fmt.Fprint(w, "{}")
+
+	case strings.HasSuffix(path, "/tags/list"):
+		f.serveTags(w, r, strings.TrimSuffix(strings.TrimPrefix(path, "/v2/"), "/tags/list"))
+
+	case strings.Contains(path, "/manifests/"):
+		i := strings.LastIndex(path, "/manifests/")
+		name, ref := strings.TrimPrefix(path[:i], "/v2/"), path[i+len("/manifests/"):]
+		key := name + ":" + ref
+		if strings.Contains(ref, ":") {
+			key = name + "@" + ref
+		}
+		m, ok := f.manifests[key]
+		if !ok {
+			fakeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+		if r.Method == http.MethodHead && f.denyHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if accept := r.Header.Get("Accept"); accept != "" && !strings.Contains(accept, m.mediaType) {
+			// Like the reference implementation, fall back to a schema1 manifest.
+			m = fakeManifest{mediaType: MediaTypeDockerSchema1, body: []byte(`{"schemaVersion":1}`)}
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(m.body)))
+		if !f.hideDigest {
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(m.body).String())
+		}
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(m.body)
+		}
+
+	case strings.Contains(path, "/blobs/"):
+		d := digest.Digest(path[strings.LastIndex(path, "/")+1:])
+		blob, ok := f.blobs[d]
+		if !ok {
+			fakeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown to registry")
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(blob)
+
+	default:
+		fakeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+	}
+}
+
+func (f *fakeRegistry) serveTags(w http.ResponseWriter, r *http.Request, name string) {
+
+	tags := []string{}
+	for key := range f.manifests {
+		if strings.HasPrefix(key, name+":") {
+			tags = append(tags, key[len(name)+1:])
+		}
+	}
+	if len(tags) == 0 {
+		fakeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		return
+	}
+	sort.Strings(tags)
+
+	if last := r.URL.Query().Get("last"); last != "" {
+		i := sort.SearchStrings(tags, last)
+		if i < len(tags) && tags[i] == last {
+			i++
+		}
+		tags = tags[i:]
+	}
+
+	if f.pageSize > 0 && len(tags) > f.pageSize {
+		tags = tags[:f.pageSize]
+		w.Header().Set("Link", fmt.Sprintf(`</v2/%s/tags/list?n=%d&last=%s>; rel="next"`, name, f.pageSize, tags[len(tags)-1]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"name":%q,"tags":["%s"]}`, name, strings.Join(tags, `","`))
+}
+
+func fakeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"errors":[{"code":%q,"message":%q}]}`, code, message)
+}
+
+// serve starts the given fake registry, and returns the host[:port] to use in references.
+func serve(t *testing.T, handler http.Handler) string {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+const fakeManifestBody = `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{}}`
+
+func TestPing(t *testing.T) {
+
+	is := require.New(t)
+
+	host := serve(t, newFakeRegistry())
+	is.NoError(Ping(context.Background(), host))
+
+	host = serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="https://auth.example.com/token"`)
+		fakeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+	}))
+	err := Ping(context.Background(), host)
+	is.Error(err)
+	e, ok := err.(*Error)
+	is.True(ok)
+	is.Equal(http.StatusUnauthorized, e.StatusCode)
+	is.Equal("UNAUTHORIZED", e.Errors[0].Code)
+	is.Equal("registry responded with status 401: unauthorized: authentication required", e.Error())
+
+}
+
+func TestManifest(t *testing.T) {
+
+	is := require.New(t)
+	ctx := context.Background()
+
+	registry := newFakeRegistry()
+	expected := registry.push("team/app", "1.0", MediaTypeOCIManifest, fakeManifestBody)
+	host := serve(t, registry)
+
+	for _, remote := range []string{host + "/team/app:1.0", host + "/team/app@" + expected.String()} {
+		ref := reftest.Parse(t, remote)
+
+		desc, err := HeadManifest(ctx, ref)
+		is.NoError(err)
+		is.Equal(MediaTypeOCIManifest, desc.MediaType)
+		is.Equal(expected, desc.Digest)
+		is.Equal(int64(len(fakeManifestBody)), desc.Size)
+
+		m, err := GetManifest(ctx, ref)
+		is.NoError(err)
+		is.Equal(*desc, m.Descriptor)
+		is.Equal(fakeManifestBody, string(m.Body))
+	}
+
+	is.Equal(strings.Join(DefaultAccept, ", "), registry.accepts[0])
+
+	client := &Client{Accept: []string{MediaTypeDockerManifest}}
+	_, err := client.HeadManifest(ctx, reftest.Parse(t, host+"/team/app:1.0"))
+	is.NoError(err)
+	is.Equal(MediaTypeDockerManifest, registry.accepts[len(registry.accepts)-1])
+
+	_, err = GetManifest(ctx, reftest.Parse(t, host+"/team/app:2.0"))
+	is.Error(err)
+	is.True(IsNotFound(err))
+	is.Contains(err.Error(), "manifest_unknown")
+
+	_, err = HeadManifest(ctx, reftest.Parse(t, host+"/team/app:2.0"))
+	is.True(IsNotFound(err))
+
+}
+
+func TestTags(t *testing.T) {
+
+	is := require.New(t)
+	ctx := context.Background()
+
+	registry := newFakeRegistry()
+	expected := []string{}
+	for i := 0; i < 7; i++ {
+		tag := "1." + strconv.Itoa(i)
+		registry.push("library/nginx", tag, MediaTypeOCIManifest, fakeManifestBody)
+		expected = append(expected, tag)
+	}
+	host := serve(t, registry)
+
+	tags, err := Tags(ctx, reftest.Parse(t, host+"/library/nginx"))
+	is.NoError(err)
+	is.Equal(expected, tags)
+	is.Len(registry.requests, 1)
+
+	registry.pageSize = 3
+	registry.requests = nil
+	tags, err = Tags(ctx, reftest.Parse(t, host+"/library/nginx:1.0"))
+	is.NoError(err)
+	is.Equal(expected, tags)
+	is.Equal([]string{
+		"GET /v2/library/nginx/tags/list",
+		"GET /v2/library/nginx/tags/list?n=3&last=1.2",
+		"GET /v2/library/nginx/tags/list?n=3&last=1.5",
+	}, registry.requests)
+
+	_, err = Tags(ctx, reftest.Parse(t, host+"/library/redis"))
+	is.True(IsNotFound(err))
+
+}
+
+func TestBlob(t *testing.T) {
+
+	is := require.New(t)
+	ctx := context.Background()
+
+	content := []byte(`{"architecture":"amd64","os":"linux"}`)
+	d := digest.FromBytes(content)
+	corrupted := digest.FromBytes([]byte("corrupted"))
+
+	registry := newFakeRegistry()
+	registry.blobs[d] = content
+	registry.blobs[corrupted] = content
+	host := serve(t, registry)
+	ref := reftest.Parse(t, host+"/team/app:1.0")
+
+	r, err := GetBlob(ctx, ref, d)
+	is.NoError(err)
+	b, err := ioutil.ReadAll(r)
+	is.NoError(err)
+	is.NoError(r.Close())
+	is.Equal(content, b)
+
+	r, err = GetBlob(ctx, ref, corrupted)
+	is.NoError(err)
+	_, err = ioutil.ReadAll(r)
+	is.Error(err)
+	is.NoError(r.Close())
+
+	_, err = GetBlob(ctx, ref, digest.FromBytes([]byte("missing")))
+	is.True(IsNotFound(err))
+
+	_, err = GetBlob(ctx, ref, digest.Digest("sha256:foo"))
+	is.Error(err)
+
+}
+
+func TestURL(t *testing.T) {
+
+	is := require.New(t)
+
+	client := &Client{Insecure: []string{"registry.local:5000"}}
+
+	tests := map[string]string{
+		"docker.io":           "https://registry-1.docker.io/v2/",
+		"gcr.io":              "https://gcr.io/v2/",
+		"registry.local:5000": "http://registry.local:5000/v2/",
+		"registry.local":      "https://registry.local/v2/",
+		"localhost:5000":      "http://localhost:5000/v2/",
+		"127.0.0.1:5000":      "http://127.0.0.1:5000/v2/",
+		"[::1]:5000":          "http://[::1]:5000/v2/",
+	}
+
+	for registry, expected := range tests {
+		is.Equal(expected, client.url(registry, "/v2/"))
+	}
+
+}
+
+func TestNextLink(t *testing.T) {
+
+	is := require.New(t)
+
+	base, err := url.Parse("https://registry.local/v2/foo/tags/list")
+	is.NoError(err)
+
+	tests := map[string]string{
+		``: "",
+		`</v2/foo/tags/list?n=2&last=b>; rel="next"`: "https://registry.local/v2/foo/tags/list?n=2&last=b",
+		`<https://cdn.local/page2>; rel=next`:        "https://cdn.local/page2",
+		`</v2/foo/tags/list?last=a>; rel="previous"`: "",
+		`</prev>; rel="prev", </next>; rel="next"`:   "https://registry.local/next",
+		`/v2/foo/tags/list?n=2&last=b; rel="next"`:   "",
+	}
+
+	for header, expected := range tests {
+		next, err := nextLink(base, header)
+		is.NoError(err)
+		is.Equal(expected, next, "unexpected link for %s", header)
+	}
+
+}
+
+func TestResolve(t *testing.T) {
+
+	is := require.New(t)
+	ctx := context.Background()
+
+	registry := newFakeRegistry()
+	index := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`
+	expected := registry.push("team/app", "1.0", MediaTypeOCIIndex, index)
+	list := registry.push("team/app", "2.0", MediaTypeDockerList, `{"schemaVersion":2,"manifests":[]}`)
+	host := serve(t, registry)
+
+	pinned, err := Resolve(ctx, reftest.Parse(t, host+"/team/app:1.0"))
+	is.NoError(err)
+	is.Equal(host+"/team/app@"+expected.String(), pinned.Remote())
+	is.Equal([]string{"HEAD /v2/team/app/manifests/1.0"}, registry.requests)
+	is.Equal(strings.Join(DefaultAccept, ", "), registry.accepts[0])
+
+	pinned, err = Resolve(ctx, reftest.Parse(t, host+"/team/app:2.0"))
+	is.NoError(err)
+	is.Equal(host+"/team/app@"+list.String(), pinned.Remote())
+
+	registry.requests = nil
+	registry.hideDigest = true
+	pinned, err = Resolve(ctx, reftest.Parse(t, host+"/team/app:1.0"))
+	is.NoError(err)
+	is.Equal(host+"/team/app@"+expected.String(), pinned.Remote())
+	is.Equal([]string{"HEAD /v2/team/app/manifests/1.0", "GET /v2/team/app/manifests/1.0"}, registry.requests)
+
+	registry.requests = nil
+	registry.hideDigest = false
+	registry.denyHead = true
+	pinned, err = Resolve(ctx, reftest.Parse(t, host+"/team/app:1.0"))
+	is.NoError(err)
+	is.Equal(host+"/team/app@"+expected.String(), pinned.Remote())
+	is.Equal([]string{"HEAD /v2/team/app/manifests/1.0", "GET /v2/team/app/manifests/1.0"}, registry.requests)
+	registry.denyHead = false
+
+	pinned, err = Resolve(ctx, reftest.Parse(t, host+"/team/app@"+expected.String()))
+	is.NoError(err)
+	is.Equal(host+"/team/app@"+expected.String(), pinned.Remote())
+
+	client := &Client{Accept: []string{MediaTypeOCIManifest, MediaTypeDockerManifest}}
+	pinned, err = client.Resolve(ctx, reftest.Parse(t, host+"/team/app:1.0"))
+	is.Error(err)
+	is.Contains(err.Error(), MediaTypeDockerSchema1)
+	is.Nil(pinned)
+
+	pinned, err = Resolve(ctx, reftest.Parse(t, host+"/team/app:3.0"))
+	is.True(IsNotFound(err))
+	is.Nil(pinned)
+
+}
+
+func TestResolveCorrupted(t *testing.T) {
+
+	is := require.New(t)
+	ctx := context.Background()
+
+	host := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", MediaTypeOCIManifest)
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes([]byte("corrupted")).String())
+		fmt.Fprint(w, fakeManifestBody)
+	}))
+
+	pinned, err := Resolve(ctx, reftest.Parse(t, host+"/team/app:1.0"))
+	is.Error(err)
+	is.Nil(pinned)
+
+	pinned, err = Resolve(ctx, reftest.Parse(t, host+"/team/app@"+digest.FromBytes([]byte("other")).String()))
+	is.Error(err)
+	is.Nil(pinned)
+
+}
+
+// fakeTokenServer is a stand-in token server issuing tokens to a user, and a registry accepting
+// only them.
+type fakeTokenServer struct {
+	mutex sync.Mutex
+	// issued maps issued tokens to their scope.
+	issued map[string]string
+	// requests records the token requests received, as "METHOD scope".
+	requests []string
+	// host is the host[:port] of the token server.
+	host string
+}
+
+func (f *fakeTokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	_ = r.ParseForm()
+	scope := r.Form.Get("scope")
+	f.requests = append(f.requests, r.Method+" "+scope)
+
+	if r.Form.Get("service") != "fake" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	case http.MethodPost:
+		if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "refresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	value := fmt.Sprintf("token-%d", len(f.requests))
+	f.issued[value] = scope
+	if r.Method == http.MethodPost {
+		fmt.Fprintf(w, `{"access_token":%q,"expires_in":300}`, value)
+		return
+	}
+	fmt.Fprintf(w, `{"token":%q,"expires_in":300,"issued_at":"2015-01-01T00:00:00Z"}`, value)
+}
+
+// protect returns a handler requiring tokens of the token server for the given registry.
+func (f *fakeTokenServer) protect(registry http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		scope := scopeOf(r.URL.Path)
+
+		f.mutex.Lock()
+		granted, ok := f.issued[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		f.mutex.Unlock()
+
+		if !ok || granted != scope {
+			challenge := fmt.Sprintf(`Bearer realm="http://%s/token",service="fake"`, f.host)
+			if scope != "" {
+				challenge += fmt.Sprintf(`,scope="%s"`, scope)
+			}
+			w.Header().Set("WWW-Authenticate", challenge)
+			fakeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+			return
+		}
+
+		registry.ServeHTTP(w, r)
+	})
+}
+
+func TestBearerAuthentication(t *testing.T) {
+
+	is := require.New(t)
+	ctx := context.Background()
+
+	registry := newFakeRegistry()
+	expected := registry.push("team/app", "1.0", MediaTypeOCIManifest, fakeManifestBody)
+	registry.push("team/other", "1.0", MediaTypeOCIManifest, fakeManifestBody)
+
+	tokens := &fakeTokenServer{issued: map[string]string{}}
+	tokens.host = serve(t, tokens)
+	host := serve(t, tokens.protect(registry))
+
+	anonymous := &Client{HTTPClient: &http.Client{Transport: &Transport{}}}
+	_, err := anonymous.Resolve(ctx, reftest.Parse(t, host+"/team/app:1.0"))
+	is.Error(err)
+	is.Equal([]string{"GET repository:team/app:pull"}, tokens.requests)
+	tokens.requests = nil
+
+	transport := &Transport{Credentials: func(_ context.Context, registry string) (*Credentials, error) {
+		is.Equal(host, registry)
+		return &Credentials{Username: "user", Password: "secret"}, nil
+	}}
+	client := &Client{HTTPClient: &http.Client{Transport: transport}}
+
+	pinned, err := client.Resolve(ctx, reftest.Parse(t, host+"/team/app:1.0"))
+	is.NoError(err)
+	is.Equal(host+"/team/app@"+expected.String(), pinned.Remote())
+
+	_, err = client.GetManifest(ctx, pinned)
+	is.NoError(err)
+	_, err = client.Tags(ctx, pinned)
+	is.NoError(err)
+	is.Equal([]string{"GET repository:team/app:pull"}, tokens.requests)
+
+	_, err = client.Tags(ctx, reftest.Parse(t, host+"/team/other"))
+	is.NoError(err)
+	is.Equal([]string{"GET repository:team/app:pull", "GET repository:team/other:pull"}, tokens.requests)
+
+	// Expired tokens are requested again.
+	transport.mutex.Lock()
+	for key, cached := range transport.tokens {
+		cached.expires = time.Now().Add(-time.Second)
+		transport.tokens[key] = cached
+	}
+	transport.mutex.Unlock()
+	_, err = client.Tags(ctx, reftest.Parse(t, host+"/team/other"))
+	is.NoError(err)
+	is.Len(tokens.requests, 3)
+
+	// Revoked tokens are requested again.
+	tokens.mutex.Lock()
+	tokens.issued = map[string]string{}
+	tokens.mutex.Unlock()
+	_, err = client.Tags(ctx, reftest.Parse(t, host+"/team/other"))
+	is.NoError(err)
+	is.Len(tokens.requests, 4)
+
+	transport = &Transport{Credentials: func(_ context.Context, registry string) (*Credentials, error) {
+		return &Credentials{IdentityToken: "refresh"}, nil
+	}}
+	client = &Client{HTTPClient: &http.Client{Transport: transport}}
+	_, err = client.GetManifest(ctx, reftest.Parse(t, host+"/team/app:1.0"))
+	is.NoError(err)
+	is.Equal("POST repository:team/app:pull", tokens.requests[len(tokens.requests)-1])
+
+}
+
+func TestBasicAuthentication(t *testing.T) {
+
+	is := require.New(t)
+	ctx := context.Background()
+
+	registry := newFakeRegistry()
+	registry.push("team/app", "1.0", MediaTypeOCIManifest, fakeManifestBody)
+
+	host := serve(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="fake"`)
+			fakeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+			return
+		}
+		registry.ServeHTTP(w, r)
+	}))
+
+	client := &Client{HTTPClient: &http.Client{Transport: &Transport{}}}
+	err := client.Ping(ctx, host)
+	is.Error(err)
+	is.Equal(http.StatusUnauthorized, err.(*Error).StatusCode)
+
+	client = &Client{HTTPClient: &http.Client{Transport: &Transport{Credentials: func(context.Context, string) (*Credentials, error) {
+		return &Credentials{Username: "user", Password: "secret"}, nil
+	}}}}
+	is.NoError(client.Ping(ctx, host))
+	_, err = client.GetManifest(ctx, reftest.Parse(t, host+"/team/app:1.0"))
+	is.NoError(err)
+	is.Len(registry.requests, 2)
+
+}
+
+func TestParseChallenges(t *testing.T) {
+
+	is := require.New(t)
+
+	challenges := ParseChallenges([]string{
+		`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"`,
+		`Basic realm="Registry \"Realm\"", charset=UTF-8`,
+		`Negotiate, Digest realm="x", qop="auth,auth-int"`,
+	})
+
+	is.Equal([]Challenge{
+		{Scheme: "bearer", Parameters: map[string]string{
+			"realm":   "https://auth.docker.io/token",
+			"service": "registry.docker.io",
+			"scope":   "repository:library/nginx:pull",
+		}},
+		{Scheme: "basic", Parameters: map[string]string{"realm": `Registry "Realm"`, "charset": "UTF-8"}},
+		{Scheme: "negotiate", Parameters: map[string]string{}},
+		{Scheme: "digest", Parameters: map[string]string{"realm": "x", "qop": "auth,auth-int"}},
+	}, challenges)
+
+	challenge, ok := preferredChallenge(challenges)
+	is.True(ok)
+	is.Equal("bearer", challenge.Scheme)
+
+	challenge, ok = preferredChallenge(challenges[1:])
+	is.True(ok)
+	is.Equal("basic", challenge.Scheme)
+
+	_, ok = preferredChallenge(challenges[2:])
+	is.False(ok)
+
+}
+
+func TestScope(t *testing.T) {
+
+	is := require.New(t)
+
+	is.Equal("repository:library/nginx:pull", Scope(reftest.Parse(t, "nginx:1.25")))
+	is.Equal("repository:team/app:pull,push", Scope(reftest.Parse(t, "registry.local:5000/team/app"), "pull", "push"))
+
+	is.Equal("repository:library/nginx:pull", scopeOf("/v2/library/nginx/manifests/latest"))
+	is.Equal("repository:a/b/c:pull", scopeOf("/v2/a/b/c/blobs/sha256:abc"))
+	is.Equal("repository:team/app:pull", scopeOf("/v2/team/app/tags/list"))
+	is.Equal("", scopeOf("/v2/"))
+
+}
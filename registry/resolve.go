@@ -0,0 +1,87 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	dockerparser "github.com/novln/docker-parser"
+)
+
+// Resolve returns the reference pinned to the digest of the manifest it identifies, in order to
+// deploy exactly the same image later. (ie: nginx:1.25 gives docker.io/library/nginx@sha256:...)
+//
+// The digest is given by the Docker-Content-Digest header of a HEAD request. If the registry
+// doesn't return it, the manifest is downloaded and its digest is computed from its content.
+// Since the digest depends on the manifest format, the manifest must have one of the accepted
+// media types: with the default ones, a multi-platform image resolves to the digest of its index.
+func (c *Client) Resolve(ctx context.Context, ref *dockerparser.Reference) (*dockerparser.Reference, error) {
+
+	desc, err := c.HeadManifest(ctx, ref)
+	if err != nil {
+		if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusMethodNotAllowed {
+			return nil, err
+		}
+		desc = &Descriptor{}
+	}
+
+	if desc.Digest == "" {
+		m, err := c.GetManifest(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		desc = &m.Descriptor
+	}
+
+	if !c.accepts(desc.MediaType) {
+		return nil, fmt.Errorf("manifest of %s has unexpected media type %s", ref.Remote(), desc.MediaType)
+	}
+	if ref.HasDigest() && desc.Digest.String() != ref.Tag() {
+		return nil, fmt.Errorf("manifest of %s has digest %s", ref.Remote(), desc.Digest)
+	}
+
+	return ref.WithDigest(desc.Digest)
+}
+
+// Resolve returns the reference pinned to the digest of the manifest it identifies, using the
+// DefaultClient.
+func Resolve(ctx context.Context, ref *dockerparser.Reference) (*dockerparser.Reference, error) {
+	return DefaultClient.Resolve(ctx, ref)
+}
+
+// accepts returns true if the media type is accepted by the client. Registries that don't return
+// any media type are trusted.
+func (c *Client) accepts(mediaType string) bool {
+
+	if mediaType == "" {
+		return true
+	}
+
+	accept := c.Accept
+	if len(accept) == 0 {
+		accept = DefaultAccept
+	}
+	for _, accepted := range accept {
+		if accepted == mediaType {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,296 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package relocate rewrites references with rules, in order to move images in bulk to another
+// registry, such as docker.io/bitnami/* to harbor.corp/dockerhub/bitnami/* for air-gapped installs.
+package relocate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/distribution/reference"
+	"github.com/novln/docker-parser/internal/suffix"
+)
+
+// DefaultSeparator joins the path components of flattened repositories.
+const DefaultSeparator = "-"
+
+// hashLength is the number of hexadecimal characters of the hash naming repositories that would be
+// too long.
+const hashLength = 16
+
+var (
+	// ErrNoRule is returned when no rule matches a reference.
+	ErrNoRule = errors.New("no relocation rule matches the reference")
+
+	// ErrIrreversible is returned when a relocated reference can't be reversed by its rule alone,
+	// because its path was flattened or hashed. A Report can still reverse it.
+	ErrIrreversible = errors.New("relocation is not reversible")
+)
+
+// Rule relocates the repositories matching a prefix.
+type Rule struct {
+	// From selects repositories with a dockerparser.Pattern whose only wildcard is a trailing /* or
+	// /**: "quay.io/**" matches any repository of quay.io, "docker.io/bitnami/*" matches the
+	// repositories directly under bitnami, and a repository without wildcard, such as "nginx",
+	// matches itself only.
+	From string
+	// To is the prefix replacing the one of From. (ie: harbor.corp/dockerhub/bitnami)
+	To string
+	// Namespace is a path inserted between To and the rest of the repository.
+	Namespace string
+	// Flatten joins the path components after the prefix with Separator, so that
+	// docker.io/bitnami/charts/nginx relocated from docker.io/** gives To/bitnami-charts-nginx.
+	Flatten bool
+	// Separator joins flattened path components. It defaults to DefaultSeparator.
+	Separator string
+
+	pattern *dockerparser.Pattern
+	// prefix is the repository selected by From without its wildcard, with its registry.
+	prefix string
+	exact  bool
+}
+
+// Relocator rewrites references with rules. When several rules match a reference, the one with the
+// longest prefix wins.
+type Relocator struct {
+	rules []Rule
+}
+
+// New returns a Relocator using the given rules.
+func New(rules ...Rule) (*Relocator, error) {
+
+	r := &Relocator{}
+
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, rule)
+	}
+
+	return r, nil
+}
+
+func (rule *Rule) compile() error {
+
+	from := strings.TrimSuffix(strings.TrimSuffix(rule.From, "/**"), "/*")
+	if from == "" || strings.Contains(from, "*") {
+		return fmt.Errorf("invalid rule %q: wildcards must be a trailing /* or /**", rule.From)
+	}
+
+	pattern, err := dockerparser.ParsePattern(rule.From)
+	if err != nil {
+		return fmt.Errorf("invalid rule %q: %s", rule.From, err)
+	}
+	rule.pattern, rule.exact = pattern, from == rule.From
+
+	// The prefix is the repository of From itself if it has no wildcard. Otherwise, it's the
+	// repository of a name under it without its last components, so that the first component is
+	// a registry if it looks like one, and "library/" is never added. (ie: quay.io, docker.io/bitnami)
+	name, trailing := from, ""
+	if !rule.exact {
+		name, trailing = from+"/x/x", "/x/x"
+	}
+	ref, err := dockerparser.Parse(name)
+	if err != nil {
+		return fmt.Errorf("invalid rule %q: %s", rule.From, err)
+	}
+	if !ref.HasImplicitTag() {
+		return fmt.Errorf("invalid rule %q: it must be a repository without tag nor digest", rule.From)
+	}
+	if under, err := dockerparser.Parse(from + "/x"); rule.exact && err == nil && under.RepositoryPath() == "x" {
+		// A registry alone, such as "quay.io", isn't a repository.
+		return fmt.Errorf("invalid rule %q: it must be a repository", rule.From)
+	}
+	rule.prefix = strings.TrimSuffix(ref.Repository(), trailing)
+
+	rule.To = strings.TrimSuffix(rule.To, "/")
+	if to, err := dockerparser.Parse(join(rule.To, "x")); err != nil || to.HasImplicitRegistry() {
+		return fmt.Errorf("invalid rule %q: destination %q must start with a registry", rule.From, rule.To)
+	}
+
+	rule.Namespace = strings.Trim(rule.Namespace, "/")
+	if rule.Namespace != "" {
+		if _, err := dockerparser.Parse("localhost/" + rule.Namespace); err != nil {
+			return fmt.Errorf("invalid rule %q: invalid namespace %q", rule.From, rule.Namespace)
+		}
+	}
+
+	if rule.Separator == "" {
+		rule.Separator = DefaultSeparator
+	}
+	switch rule.Separator {
+	case ".", "_", "__", "-":
+	default:
+		return fmt.Errorf("invalid rule %q: separator must be one of . _ __ -", rule.From)
+	}
+
+	return nil
+}
+
+// match returns the rest of the repository of the reference after the prefix of the rule, and true
+// if it matches.
+func (rule *Rule) match(ref *dockerparser.Reference) (string, bool) {
+
+	if !rule.pattern.Match(ref) {
+		return "", false
+	}
+	if rule.exact {
+		return "", true
+	}
+
+	// A trailing /** also matches the prefix itself, which has no rest to relocate.
+	rest := strings.TrimPrefix(ref.Repository(), rule.prefix+"/")
+	if rest == ref.Repository() {
+		return "", false
+	}
+
+	return rest, true
+}
+
+// find returns the matching rule with the longest prefix, and the rest of the repository.
+func (r *Relocator) find(ref *dockerparser.Reference) (*Rule, string, bool) {
+
+	var best *Rule
+	var rest string
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if s, ok := rule.match(ref); ok && (best == nil || len(rule.prefix) > len(best.prefix)) {
+			best, rest = rule, s
+		}
+	}
+
+	return best, rest, best != nil
+}
+
+// Relocate returns the reference rewritten by the matching rule, with the same tag or digest.
+// If the relocated name would exceed reference.NameTotalLengthMax, the path after To and Namespace
+// is replaced with its last component and a hash of the original repository. It returns ErrNoRule
+// if no rule matches.
+func (r *Relocator) Relocate(ref *dockerparser.Reference) (*dockerparser.Reference, error) {
+	relocated, _, err := r.relocate(ref)
+	return relocated, err
+}
+
+func (r *Relocator) relocate(ref *dockerparser.Reference) (*dockerparser.Reference, *Rule, error) {
+
+	rule, rest, ok := r.find(ref)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: %s", ref.Remote(), ErrNoRule)
+	}
+
+	if rule.Flatten {
+		rest = strings.Replace(rest, "/", rule.Separator, -1)
+	}
+
+	name := join(join(rule.To, rule.Namespace), rest)
+	if len(name) > reference.NameTotalLengthMax {
+		name = join(join(rule.To, rule.Namespace), hashed(ref.Repository()))
+	}
+
+	relocated, err := dockerparser.Parse(name + suffix.Of(ref))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: invalid relocation %q: %s", ref.Remote(), name, err)
+	}
+
+	return relocated, rule, nil
+}
+
+// Reverse returns the original reference of a relocated one, if a rule relocated it without
+// flattening nor hashing its path. Otherwise, it returns ErrIrreversible: use a Report instead.
+// Repositories named like hashed paths, with a dash and 16 hexadecimal characters, are considered
+// hashed.
+func (r *Relocator) Reverse(relocated *dockerparser.Reference) (*dockerparser.Reference, error) {
+
+	repository := relocated.Repository()
+	err := ErrNoRule
+
+	for i := range r.rules {
+		rule := &r.rules[i]
+
+		rest := strings.TrimPrefix(repository, join(rule.To, rule.Namespace))
+		if rest == repository || (rest != "" && rest[0] != '/') {
+			continue
+		}
+		rest = strings.TrimPrefix(rest, "/")
+		if rule.exact != (rest == "") {
+			continue
+		}
+
+		original, e := dockerparser.Parse(join(rule.prefix, rest) + suffix.Of(relocated))
+		if e != nil {
+			continue
+		}
+		if _, ok := rule.match(original); !ok {
+			continue
+		}
+
+		err = ErrIrreversible
+		if (rule.Flatten && strings.Contains(rest, rule.Separator)) || isHashed(rest) {
+			continue
+		}
+
+		// The original might be relocated by another rule with a longer prefix: check that it gives
+		// back the same reference.
+		if again, e := r.Relocate(original); e == nil && again.Remote() == relocated.Remote() {
+			return original, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s: %s", relocated.Remote(), err)
+}
+
+// hashed returns a repository path made of the last component of the repository and a hash of it.
+func hashed(repository string) string {
+
+	sum := sha256.Sum256([]byte(repository))
+	base := repository[strings.LastIndexByte(repository, '/')+1:]
+	if max := reference.NameTotalLengthMax / 2; len(base) > max {
+		base = strings.TrimRight(base[:max], "._-")
+	}
+
+	return base + "-" + hex.EncodeToString(sum[:])[:hashLength]
+}
+
+// isHashed returns true if the path looks like a hashed one. Such paths are never reversed, since
+// the original repository can't be told apart from a repository named like the hashed path.
+func isHashed(path string) bool {
+
+	i := len(path) - hashLength - 1
+	if strings.Contains(path, "/") || i < 1 || path[i] != '-' {
+		return false
+	}
+	_, err := hex.DecodeString(path[i+1:])
+
+	return err == nil && strings.ToLower(path[i+1:]) == path[i+1:]
+}
+
+func join(prefix, path string) string {
+	switch {
+	case prefix == "":
+		return path
+	case path == "":
+		return prefix
+	default:
+		return prefix + "/" + path
+	}
+}
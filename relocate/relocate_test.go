@@ -0,0 +1,221 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package relocate
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/distribution/reference"
+	"github.com/novln/docker-parser/internal/reftest"
+	"github.com/stretchr/testify/require"
+)
+
+const testDigest = "sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb"
+
+func relocator(is *require.Assertions) *Relocator {
+	r, err := New(
+		Rule{From: "docker.io/bitnami/*", To: "harbor.corp/dockerhub/bitnami"},
+		Rule{From: "quay.io/**", To: "harbor.corp/quay"},
+		Rule{From: "docker.io/**", To: "harbor.corp/flat/", Flatten: true},
+		Rule{From: "nginx", To: "harbor.corp/dockerhub/nginx"},
+		Rule{From: "gcr.io/**", To: "harbor.corp", Namespace: "/mirrors/gcr/", Flatten: true, Separator: "__"},
+	)
+	is.NoError(err)
+	return r
+}
+
+func TestNew(t *testing.T) {
+
+	is := require.New(t)
+
+	invalid := []Rule{
+		{From: "", To: "harbor.corp"},
+		{From: "docker.io/*/app", To: "harbor.corp"},
+		{From: "docker.io/bitnami*", To: "harbor.corp"},
+		{From: "quay.io", To: "harbor.corp"},
+		{From: "nginx:1.25", To: "harbor.corp"},
+		{From: "Nginx", To: "harbor.corp"},
+		{From: "quay.io/**", To: "harbor"},
+		{From: "quay.io/**", To: "harbor.corp/Quay"},
+		{From: "quay.io/**", To: "harbor.corp/quay:latest"},
+		{From: "quay.io/**", To: "harbor.corp", Namespace: "Quay"},
+		{From: "quay.io/**", To: "harbor.corp", Separator: "+"},
+	}
+
+	for _, rule := range invalid {
+		r, err := New(rule)
+		is.Error(err, "an error was expected for %+v", rule)
+		is.Nil(r)
+	}
+
+}
+
+func TestRelocate(t *testing.T) {
+
+	is := require.New(t)
+
+	r := relocator(is)
+
+	tests := map[string]string{
+		"bitnami/redis:7.0":                            "harbor.corp/dockerhub/bitnami/redis:7.0",
+		"docker.io/bitnami/charts/nginx:1":             "harbor.corp/flat/bitnami-charts-nginx:1",
+		"quay.io/prometheus/node-exporter":             "harbor.corp/quay/prometheus/node-exporter:latest",
+		"quay.io/coreos/etcd@" + testDigest:            "harbor.corp/quay/coreos/etcd@" + testDigest,
+		"nginx:1.25":                                   "harbor.corp/dockerhub/nginx:1.25",
+		"index.docker.io/library/nginx":                "harbor.corp/dockerhub/nginx:latest",
+		"alpine:3.18":                                  "harbor.corp/flat/library-alpine:3.18",
+		"gcr.io/distroless/static:nonroot":             "harbor.corp/mirrors/gcr/distroless__static:nonroot",
+		"gcr.io/google-containers/pause@" + testDigest: "harbor.corp/mirrors/gcr/google-containers__pause@" + testDigest,
+	}
+
+	for remote, expected := range tests {
+		relocated, err := r.Relocate(reftest.Parse(t, remote))
+		is.NoError(err, "relocate error was not expected for %s", remote)
+		is.Equal(expected, relocated.Remote())
+	}
+
+	relocated, err := r.Relocate(reftest.Parse(t, "ghcr.io/team/app"))
+	is.Error(err)
+	is.Contains(err.Error(), ErrNoRule.Error())
+	is.Nil(relocated)
+
+	// quay.io/ + 241 characters is valid, but harbor.corp/quay/ + 241 characters is too long.
+	long := "quay.io/" + strings.Repeat("a", 120) + "/" + strings.Repeat("b", 120)
+	relocated, err = r.Relocate(reftest.Parse(t, long+":1.0"))
+	is.NoError(err)
+	is.True(len(relocated.Repository()) <= reference.NameTotalLengthMax)
+	is.True(strings.HasPrefix(relocated.Remote(), "harbor.corp/quay/"+strings.Repeat("b", 120)+"-"))
+	is.Len(relocated.Repository(), len("harbor.corp/quay/")+120+1+hashLength)
+	is.Equal("1.0", relocated.Tag())
+
+	again, err := r.Relocate(reftest.Parse(t, long+":1.0"))
+	is.NoError(err)
+	is.Equal(relocated.Remote(), again.Remote())
+
+}
+
+func TestReverse(t *testing.T) {
+
+	is := require.New(t)
+
+	r := relocator(is)
+
+	tests := map[string]string{
+		"harbor.corp/dockerhub/bitnami/redis:7.0":       "docker.io/bitnami/redis:7.0",
+		"harbor.corp/quay/coreos/etcd@" + testDigest:    "quay.io/coreos/etcd@" + testDigest,
+		"harbor.corp/dockerhub/nginx:1.25":              "docker.io/library/nginx:1.25",
+		"harbor.corp/mirrors/gcr/distroless:latest":     "gcr.io/distroless:latest",
+		"harbor.corp/mirrors/gcr/google-containers:1.0": "gcr.io/google-containers:1.0",
+	}
+
+	for remote, expected := range tests {
+		original, err := r.Reverse(reftest.Parse(t, remote))
+		is.NoError(err, "reverse error was not expected for %s", remote)
+		is.Equal(expected, original.Remote())
+	}
+
+	long := "quay.io/" + strings.Repeat("a", 120) + "/" + strings.Repeat("b", 120)
+	relocated, err := r.Relocate(reftest.Parse(t, long))
+	is.NoError(err)
+
+	irreversible := []string{
+		"harbor.corp/flat/bitnami-charts-nginx:1",
+		"harbor.corp/flat/library-alpine:3.18",
+		"harbor.corp/mirrors/gcr/distroless__static:nonroot",
+		relocated.Remote(),
+	}
+
+	for _, remote := range irreversible {
+		original, err := r.Reverse(reftest.Parse(t, remote))
+		is.Error(err, "an error was expected for %s", remote)
+		is.Contains(err.Error(), ErrIrreversible.Error())
+		is.Nil(original)
+	}
+
+	original, err := r.Reverse(reftest.Parse(t, "registry.local/team/app"))
+	is.Error(err)
+	is.Contains(err.Error(), ErrNoRule.Error())
+	is.Nil(original)
+
+}
+
+func TestRelocateAll(t *testing.T) {
+
+	is := require.New(t)
+
+	r := relocator(is)
+
+	long := "quay.io/" + strings.Repeat("a", 120) + "/" + strings.Repeat("b", 120)
+	refs := []*dockerparser.Reference{
+		reftest.Parse(t, "bitnami/redis:7.0"),
+		reftest.Parse(t, "alpine:3.18"),
+		reftest.Parse(t, long),
+		reftest.Parse(t, "docker.io/bitnami/redis:7.0"),
+	}
+
+	report, err := r.RelocateAll(refs)
+	is.NoError(err)
+	is.Len(report.Mappings, 3)
+	is.Equal(Mapping{
+		Source:     "docker.io/bitnami/redis:7.0",
+		Target:     "harbor.corp/dockerhub/bitnami/redis:7.0",
+		Rule:       "docker.io/bitnami/*",
+		Reversible: true,
+	}, report.Mappings[0])
+	is.Equal("docker.io/**", report.Mappings[1].Rule)
+	is.False(report.Mappings[1].Reversible)
+	is.False(report.Mappings[2].Reversible)
+
+	original, ok := report.Reverse(reftest.Parse(t, report.Mappings[2].Target))
+	is.True(ok)
+	is.Equal(long+":latest", original.Remote())
+
+	original, ok = report.Reverse(reftest.Parse(t, "harbor.corp/flat/library-alpine:3.18"))
+	is.True(ok)
+	is.Equal("docker.io/library/alpine:3.18", original.Remote())
+
+	original, ok = report.Reverse(reftest.Parse(t, "harbor.corp/flat/library-alpine:3.19"))
+	is.False(ok)
+	is.Nil(original)
+
+	lines := strings.Split(strings.TrimSpace(report.String()), "\n")
+	is.Len(lines, 3)
+	is.Equal("docker.io/library/alpine:3.18 harbor.corp/flat/library-alpine:3.18", lines[1])
+
+	buffer := &bytes.Buffer{}
+	is.NoError(report.WriteJSON(buffer))
+	decoded := &Report{}
+	is.NoError(json.Unmarshal(buffer.Bytes(), decoded))
+	is.Equal(report, decoded)
+
+	report, err = r.RelocateAll([]*dockerparser.Reference{
+		reftest.Parse(t, "team/a-b:1.0"),
+		reftest.Parse(t, "team-a/b:1.0"),
+	})
+	is.Error(err)
+	is.Contains(err.Error(), "harbor.corp/flat/team-a-b:1.0")
+	is.Nil(report)
+
+	report, err = r.RelocateAll([]*dockerparser.Reference{reftest.Parse(t, "ghcr.io/team/app")})
+	is.Error(err)
+	is.Nil(report)
+
+}
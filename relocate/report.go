@@ -0,0 +1,115 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package relocate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	dockerparser "github.com/novln/docker-parser"
+)
+
+// Mapping is the relocation of a reference.
+type Mapping struct {
+	// Source is the original reference.
+	Source string `json:"source"`
+	// Target is the relocated reference.
+	Target string `json:"target"`
+	// Rule is the From of the rule that relocated the reference.
+	Rule string `json:"rule"`
+	// Reversible is true if Relocator.Reverse gives back Source from Target.
+	Reversible bool `json:"reversible"`
+}
+
+// Report lists the relocations of a set of references, in order to copy the images and to reverse
+// relocations which aren't reversible by their rule.
+type Report struct {
+	Mappings []Mapping `json:"mappings"`
+}
+
+// RelocateAll relocates the given references and returns their mappings. It fails if a reference
+// doesn't match any rule, or if two different references would be relocated to the same target.
+// Duplicated references are reported once.
+func (r *Relocator) RelocateAll(refs []*dockerparser.Reference) (*Report, error) {
+
+	report := &Report{Mappings: []Mapping{}}
+	sources := map[string]string{}
+
+	for _, ref := range refs {
+
+		relocated, rule, err := r.relocate(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		source, target := ref.Remote(), relocated.Remote()
+		if previous, ok := sources[target]; ok {
+			if previous == source {
+				continue
+			}
+			return nil, fmt.Errorf("%s and %s are both relocated to %s", previous, source, target)
+		}
+		sources[target] = source
+
+		reversed, err := r.Reverse(relocated)
+		report.Mappings = append(report.Mappings, Mapping{
+			Source:     source,
+			Target:     target,
+			Rule:       rule.From,
+			Reversible: err == nil && reversed.Remote() == source,
+		})
+	}
+
+	return report, nil
+}
+
+// Reverse returns the original reference of a relocated one, and true if the report has it.
+func (r *Report) Reverse(relocated *dockerparser.Reference) (*dockerparser.Reference, bool) {
+
+	for _, mapping := range r.Mappings {
+		if mapping.Target != relocated.Remote() {
+			continue
+		}
+		original, err := dockerparser.Parse(mapping.Source)
+		if err != nil {
+			return nil, false
+		}
+		return original, true
+	}
+
+	return nil, false
+}
+
+// WriteJSON writes the report as JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// String returns the report with a mapping per line, as "source target".
+func (r *Report) String() string {
+
+	builder := &strings.Builder{}
+	for _, mapping := range r.Mappings {
+		fmt.Fprintf(builder, "%s %s\n", mapping.Source, mapping.Target)
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,214 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sysregistries
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/docker"
+	"github.com/novln/docker-parser/internal/suffix"
+)
+
+// aliasCache is the path of the alias cache file, relative to the home directory of the user.
+const aliasCache = ".cache/containers/short-name-aliases.conf"
+
+// AliasCachePath returns the path of the alias cache file of the current user, where the choices
+// of short names are recorded, or an empty string if the user has no home directory.
+func AliasCachePath() string {
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, filepath.FromSlash(aliasCache))
+}
+
+// Alias returns the reference designated by the alias of the short name of the given reference,
+// with its tag or digest, if there is one. (ie: nginx:1.25 with the alias nginx =
+// "docker.io/library/nginx" gives docker.io/library/nginx:1.25)
+func (c *Config) Alias(ref *dockerparser.Reference) (*dockerparser.Reference, bool) {
+
+	if !ref.HasImplicitRegistry() {
+		return nil, false
+	}
+
+	value, ok := c.lookupAlias(aliasKey(ref))
+	if !ok {
+		return nil, false
+	}
+
+	aliased, err := dockerparser.Parse(value + suffix.Of(ref))
+	if err != nil {
+		return nil, false
+	}
+
+	return aliased, true
+}
+
+// lookupAlias returns the alias of the given short name, as returned by aliasKey.
+func (c *Config) lookupAlias(name string) (string, bool) {
+
+	if value, ok := c.Aliases[name]; ok {
+		return value, true
+	}
+	for key, value := range c.Aliases {
+		if k, err := dockerparser.Parse(key); err == nil && aliasKey(k) == name {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// LoadAliases reads the [aliases] table of the given file, such as the alias cache file, and merges
+// it in the configuration. Like containers tools, aliases already defined by the configuration take
+// precedence over the ones of the file. Other settings of the file are ignored.
+func (c *Config) LoadAliases(path string) error {
+
+	aliases, err := readAliases(path)
+	if err != nil {
+		return err
+	}
+
+	for name := range aliases {
+		// Aliases were validated, so their short name is a valid reference.
+		ref, _ := dockerparser.Parse(name)
+		if _, ok := c.lookupAlias(aliasKey(ref)); ok {
+			delete(aliases, name)
+		}
+	}
+
+	c.merge(&Config{Aliases: aliases})
+
+	return nil
+}
+
+// RecordAlias records that the short name designates the given fully-qualified name, in the
+// configuration and in the [aliases] table of the given file, such as the alias cache file. The
+// file and its directory are created if needed, and other aliases of the file are kept. Tags and
+// digests are ignored. (ie: nginx and docker.io/library/nginx:1.25 record nginx =
+// "docker.io/library/nginx")
+func (c *Config) RecordAlias(path, name string, ref *dockerparser.Reference) error {
+
+	if ref.HasImplicitRegistry() {
+		return fmt.Errorf("invalid alias %q: %q must be a fully-qualified name", name, ref.Remote())
+	}
+	value := ref.Repository()
+	if err := validateAlias(name, value); err != nil {
+		return err
+	}
+
+	aliases, err := readAliases(path)
+	if os.IsNotExist(err) {
+		aliases, err = map[string]string{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	aliases[name] = value
+
+	buffer := &bytes.Buffer{}
+	err = toml.NewEncoder(buffer).Encode(struct {
+		Aliases map[string]string `toml:"aliases"`
+	}{aliases})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	// Write a temporary file first, so that concurrent readers never see a partial file.
+	file, err := ioutil.TempFile(filepath.Dir(path), ".short-name-aliases")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(buffer.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return err
+	}
+
+	c.merge(&Config{Aliases: map[string]string{name: value}})
+
+	return nil
+}
+
+// readAliases returns the [aliases] table of the given file.
+func readAliases(path string) (map[string]string, error) {
+
+	content := struct {
+		Aliases map[string]string `toml:"aliases"`
+	}{}
+	if _, err := toml.DecodeFile(path, &content); err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("invalid alias file %s: %s", path, err)
+	}
+
+	for name, value := range content.Aliases {
+		if err := validateAlias(name, value); err != nil {
+			return nil, fmt.Errorf("invalid alias file %s: %s", path, err)
+		}
+	}
+
+	return content.Aliases, nil
+}
+
+// validateAlias checks that an alias maps a short name without tag nor digest to a fully-qualified
+// name without tag nor digest.
+func validateAlias(name, value string) error {
+
+	ref, err := dockerparser.Parse(name)
+	if err != nil || !ref.HasImplicitRegistry() || !ref.HasImplicitTag() {
+		return fmt.Errorf("invalid alias %q: it must be a short name without tag nor digest", name)
+	}
+
+	ref, err = dockerparser.Parse(value)
+	if err != nil || ref.HasImplicitRegistry() || !ref.HasImplicitTag() {
+		return fmt.Errorf("invalid alias %q: %q must be a fully-qualified name without tag nor digest", name, value)
+	}
+
+	return nil
+}
+
+// aliasKey returns the short name of a reference as written in alias tables, without the
+// "library/" prefix of official images if it wasn't written.
+func aliasKey(ref *dockerparser.Reference) string {
+	if ref.HasImplicitNamespace() {
+		return strings.TrimPrefix(ref.ShortName(), docker.DefaultRepoPrefix)
+	}
+	return ref.ShortName()
+}
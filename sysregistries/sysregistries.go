@@ -0,0 +1,463 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package sysregistries reads the registries configuration of containers tools such as Podman,
+// Buildah or CRI-O (ie: /etc/containers/registries.conf, in its version 2 format), in order to
+// resolve references the same way: short names are resolved with their alias or qualified with the
+// search registries, and references are pulled from mirrors or rewritten locations, unless their
+// registry is blocked.
+package sysregistries
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/docker"
+	"github.com/novln/docker-parser/internal/suffix"
+)
+
+// DefaultPath is the path of the system-wide configuration file.
+const DefaultPath = "/etc/containers/registries.conf"
+
+// ShortNameMode defines how references without registry are resolved.
+type ShortNameMode string
+
+const (
+	// ShortNameDisabled tries every search registry in order.
+	ShortNameDisabled ShortNameMode = "disabled"
+	// ShortNamePermissive tries every search registry in order, unless the caller can prompt the
+	// user to choose one.
+	ShortNamePermissive ShortNameMode = "permissive"
+	// ShortNameEnforcing requires a single candidate, or a choice of the user.
+	ShortNameEnforcing ShortNameMode = "enforcing"
+)
+
+// Policies of mirrors.
+const (
+	// PullFromMirrorAll uses the mirror for references with a tag or a digest.
+	PullFromMirrorAll = "all"
+	// PullFromMirrorDigestOnly uses the mirror only for references with a digest.
+	PullFromMirrorDigestOnly = "digest-only"
+	// PullFromMirrorTagOnly uses the mirror only for references with a tag.
+	PullFromMirrorTagOnly = "tag-only"
+)
+
+var (
+	// ErrBlocked is returned when a reference belongs to a blocked registry.
+	ErrBlocked = errors.New("registry is blocked in registries configuration")
+
+	// ErrNoSearchRegistries is returned when a short name can't be qualified because no search
+	// registry is configured.
+	ErrNoSearchRegistries = errors.New("short name can't be resolved: no unqualified-search-registries are defined")
+
+	// ErrAmbiguousShortName is returned when a short name has several candidates in enforcing mode.
+	ErrAmbiguousShortName = errors.New("short name is ambiguous: several unqualified-search-registries are defined in enforcing mode")
+)
+
+// Mirror is a mirror of a registry.
+type Mirror struct {
+	// Location is the location of the mirror, as host[:port][/path].
+	Location string `toml:"location"`
+	// Insecure allows plain HTTP and unverified TLS certificates.
+	Insecure bool `toml:"insecure"`
+	// PullFromMirror restricts the references pulled from the mirror: PullFromMirrorAll (the
+	// default), PullFromMirrorDigestOnly or PullFromMirrorTagOnly.
+	PullFromMirror string `toml:"pull-from-mirror"`
+}
+
+// Registry is a [[registry]] table of the configuration.
+type Registry struct {
+	// Prefix selects the references the table applies to, such as example.com/foo or
+	// *.example.com. It defaults to Location.
+	Prefix string `toml:"prefix"`
+	// Location rewrites the prefix of references. (ie: prefix example.com/foo and location
+	// internal.example.com/bar/foo pull example.com/foo/app from internal.example.com/bar/foo/app)
+	Location string `toml:"location"`
+	// Insecure allows plain HTTP and unverified TLS certificates.
+	Insecure bool `toml:"insecure"`
+	// Blocked forbids pulling references matching the prefix.
+	Blocked bool `toml:"blocked"`
+	// MirrorByDigestOnly restricts mirrors to references with a digest.
+	MirrorByDigestOnly bool `toml:"mirror-by-digest-only"`
+	// Mirrors are tried in order before Location.
+	Mirrors []Mirror `toml:"mirror"`
+}
+
+// Config is a registries configuration.
+type Config struct {
+	// UnqualifiedSearchRegistries are the registries used in order to qualify short names.
+	UnqualifiedSearchRegistries []string `toml:"unqualified-search-registries"`
+	// Registries are the [[registry]] tables.
+	Registries []Registry `toml:"registry"`
+	// ShortNameMode defines how short names are resolved. It defaults to ShortNamePermissive.
+	ShortNameMode ShortNameMode `toml:"short-name-mode"`
+	// Aliases maps short names to fully-qualified names, such as nginx to docker.io/library/nginx.
+	Aliases map[string]string `toml:"aliases"`
+}
+
+// Source is a location a reference can be pulled from.
+type Source struct {
+	// Reference is the reference to pull.
+	Reference *dockerparser.Reference
+	// Insecure allows plain HTTP and unverified TLS certificates.
+	Insecure bool
+	// Mirror is true if the source is a mirror rather than the registry itself.
+	Mirror bool
+}
+
+// Load reads a registries configuration.
+func Load(r io.Reader) (*Config, error) {
+
+	config := &Config{}
+	if _, err := toml.DecodeReader(r, config); err != nil {
+		return nil, fmt.Errorf("invalid registries configuration: %s", err)
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid registries configuration: %s", err)
+	}
+
+	return config, nil
+}
+
+// LoadFile reads the registries configuration at the given path.
+func LoadFile(path string) (*Config, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Load(file)
+}
+
+// LoadDefault reads the registries configuration of the current user, like containers tools do:
+//
+//   - $HOME/.config/containers/registries.conf if it exists, or DefaultPath otherwise,
+//   - the drop-in files of DefaultPath.d, then of $HOME/.config/containers/registries.conf.d,
+//   - the aliases recorded in the cache file of AliasCachePath, unless the configuration defines
+//     them already.
+//
+// Missing files are ignored.
+func LoadDefault() (*Config, error) {
+
+	path, dirs := DefaultPath, []string{DefaultPath + ".d"}
+	if home, err := os.UserHomeDir(); err == nil {
+		user := filepath.Join(home, ".config", "containers", "registries.conf")
+		if _, err := os.Stat(user); err == nil {
+			path = user
+		}
+		dirs = append(dirs, user+".d")
+	}
+
+	config, err := LoadFile(path)
+	if os.IsNotExist(err) {
+		config, err = &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range dirs {
+		if err := config.LoadDropIns(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	if cache := AliasCachePath(); cache != "" {
+		if err := config.LoadAliases(cache); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+// LoadDropIns reads the *.conf files of the given directory in lexical order, and merges them in
+// the configuration: they replace its search registries and short name mode if they define them,
+// its [[registry]] tables with the same prefix, and its aliases with the same short name. A missing
+// directory is ignored.
+func (c *Config) LoadDropIns(dir string) error {
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		dropIn, err := LoadFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		c.merge(dropIn)
+	}
+
+	return nil
+}
+
+func (c *Config) merge(o *Config) {
+
+	if o.UnqualifiedSearchRegistries != nil {
+		c.UnqualifiedSearchRegistries = o.UnqualifiedSearchRegistries
+	}
+	if o.ShortNameMode != "" {
+		c.ShortNameMode = o.ShortNameMode
+	}
+
+	for _, r := range o.Registries {
+		replaced := false
+		for i := range c.Registries {
+			if c.Registries[i].Prefix == r.Prefix {
+				c.Registries[i], replaced = r, true
+			}
+		}
+		if !replaced {
+			c.Registries = append(c.Registries, r)
+		}
+	}
+
+	for name, value := range o.Aliases {
+		if c.Aliases == nil {
+			c.Aliases = map[string]string{}
+		}
+		c.Aliases[name] = value
+	}
+}
+
+func (c *Config) validate() error {
+
+	switch c.ShortNameMode {
+	case "", ShortNameDisabled, ShortNamePermissive, ShortNameEnforcing:
+	default:
+		return fmt.Errorf("invalid short-name-mode %q", c.ShortNameMode)
+	}
+
+	for _, host := range c.UnqualifiedSearchRegistries {
+		if host == "" || strings.ContainsAny(host, "/@") {
+			return fmt.Errorf("invalid unqualified-search-registries entry %q", host)
+		}
+	}
+
+	prefixes := map[string]bool{}
+	for i := range c.Registries {
+		r := &c.Registries[i]
+		r.Location = strings.TrimSuffix(r.Location, "/")
+		r.Prefix = strings.TrimSuffix(r.Prefix, "/")
+		if r.Prefix == "" {
+			r.Prefix = r.Location
+		}
+		if r.Prefix == "" {
+			return errors.New("registry without prefix nor location")
+		}
+		if strings.Contains(r.Prefix, "*") && (!strings.HasPrefix(r.Prefix, "*.") || strings.ContainsAny(r.Prefix[1:], "*/")) {
+			return fmt.Errorf("invalid prefix %q: wildcards must be like *.example.com", r.Prefix)
+		}
+		if strings.HasPrefix(r.Prefix, "*.") && r.Location != "" {
+			return fmt.Errorf("invalid location %q: prefix %q has a wildcard", r.Location, r.Prefix)
+		}
+		if prefixes[r.Prefix] {
+			return fmt.Errorf("duplicate prefix %q", r.Prefix)
+		}
+		prefixes[r.Prefix] = true
+
+		for j := range r.Mirrors {
+			m := &r.Mirrors[j]
+			m.Location = strings.TrimSuffix(m.Location, "/")
+			if m.Location == "" {
+				return fmt.Errorf("mirror of %q without location", r.Prefix)
+			}
+			switch m.PullFromMirror {
+			case "", PullFromMirrorAll, PullFromMirrorDigestOnly, PullFromMirrorTagOnly:
+			default:
+				return fmt.Errorf("invalid pull-from-mirror %q of %q", m.PullFromMirror, m.Location)
+			}
+		}
+	}
+
+	for name, value := range c.Aliases {
+		if err := validateAlias(name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindRegistry returns the [[registry]] table with the longest prefix matching the reference, or
+// nil if there is none. Exact prefixes win over wildcard ones.
+func (c *Config) FindRegistry(ref *dockerparser.Reference) *Registry {
+
+	repository := ref.Repository()
+	// Wildcard prefixes match the host without its port, like containers tools do.
+	host := ref.Registry()
+	if i := strings.LastIndexByte(host, ':'); i != -1 {
+		host = host[:i]
+	}
+
+	var best *Registry
+	score := -1
+
+	for i := range c.Registries {
+		r := &c.Registries[i]
+		s := -1
+		switch {
+		case strings.HasPrefix(r.Prefix, "*."):
+			if strings.HasSuffix(host, r.Prefix[1:]) {
+				s = len(r.Prefix)
+			}
+		case repository == r.Prefix || strings.HasPrefix(repository, r.Prefix+"/"):
+			// Exact prefixes always outrank wildcard ones, which can't be longer than a host.
+			s = len(r.Prefix) + 1<<16
+		}
+		if s > score {
+			best, score = r, s
+		}
+	}
+
+	return best
+}
+
+// Sources returns the locations the reference is pulled from, in order: the mirrors of its
+// registry that accept it, then its registry itself at its rewritten location. It returns
+// ErrBlocked if its registry is blocked.
+//
+// A reference without registry is resolved as given, in docker.io: use Candidates first to qualify
+// short names with the search registries.
+func (c *Config) Sources(ref *dockerparser.Reference) ([]Source, error) {
+
+	r := c.FindRegistry(ref)
+	if r == nil {
+		return []Source{{Reference: ref}}, nil
+	}
+	if r.Blocked {
+		return nil, fmt.Errorf("%s: %s", ref.Remote(), ErrBlocked)
+	}
+
+	sources := []Source{}
+
+	for _, m := range r.Mirrors {
+		policy := m.PullFromMirror
+		if policy == "" && r.MirrorByDigestOnly {
+			policy = PullFromMirrorDigestOnly
+		}
+		if (policy == PullFromMirrorDigestOnly && !ref.HasDigest()) || (policy == PullFromMirrorTagOnly && ref.HasDigest()) {
+			continue
+		}
+		mirrored, err := rewrite(ref, r.Prefix, m.Location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mirror %q: %s", m.Location, err)
+		}
+		sources = append(sources, Source{Reference: mirrored, Insecure: m.Insecure, Mirror: true})
+	}
+
+	primary := ref
+	if r.Location != "" && r.Location != r.Prefix {
+		rewritten, err := rewrite(ref, r.Prefix, r.Location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid location %q: %s", r.Location, err)
+		}
+		primary = rewritten
+	}
+	sources = append(sources, Source{Reference: primary, Insecure: r.Insecure})
+
+	return sources, nil
+}
+
+// Candidates returns the fully-qualified references a reference may designate. A reference with a
+// registry is its only candidate. A reference without registry, such as nginx:1.25, is resolved
+// with its alias if it has one and the short name mode isn't disabled. Otherwise, it's qualified
+// with each search registry in order, instead of always assuming docker.io. Candidates of blocked
+// registries are skipped.
+//
+// It returns ErrNoSearchRegistries if no search registry is configured, and ErrAmbiguousShortName,
+// along with the candidates, if the short name mode is enforcing and there are several of them:
+// the caller is expected to ask the user to choose one.
+func (c *Config) Candidates(ref *dockerparser.Reference) ([]*dockerparser.Reference, error) {
+
+	if !ref.HasImplicitRegistry() {
+		return []*dockerparser.Reference{ref}, nil
+	}
+	if c.ShortNameMode != ShortNameDisabled {
+		if aliased, ok := c.Alias(ref); ok {
+			return []*dockerparser.Reference{aliased}, nil
+		}
+	}
+	if len(c.UnqualifiedSearchRegistries) == 0 {
+		return nil, ErrNoSearchRegistries
+	}
+
+	candidates := []*dockerparser.Reference{}
+	for _, host := range c.UnqualifiedSearchRegistries {
+		candidate, err := Qualify(ref, host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid search registry %q: %s", host, err)
+		}
+		if r := c.FindRegistry(candidate); r != nil && r.Blocked {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	if c.ShortNameMode == ShortNameEnforcing && len(candidates) > 1 {
+		return candidates, ErrAmbiguousShortName
+	}
+
+	return candidates, nil
+}
+
+// Parse returns the fully-qualified references the given remote identifier may designate: it's
+// analyzed with dockerparser.Parse, and resolved with Candidates.
+func (c *Config) Parse(remote string) ([]*dockerparser.Reference, error) {
+
+	ref, err := dockerparser.Parse(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Candidates(ref)
+}
+
+// Qualify returns the reference in the given registry. (ie: nginx:1.25 in quay.io gives
+// quay.io/nginx:1.25, and docker.io/library/nginx:1.25 in docker.io) The "library/" prefix is
+// kept if it was given: library/nginx in quay.io gives quay.io/library/nginx.
+func Qualify(ref *dockerparser.Reference, host string) (*dockerparser.Reference, error) {
+	path := ref.ShortName()
+	if ref.HasImplicitNamespace() {
+		path = strings.TrimPrefix(path, docker.DefaultRepoPrefix)
+	}
+	return dockerparser.Parse(host + "/" + path + suffix.Of(ref))
+}
+
+// rewrite replaces the prefix of the repository of the reference with the given location.
+func rewrite(ref *dockerparser.Reference, prefix, location string) (*dockerparser.Reference, error) {
+
+	repository := ref.Repository()
+	if strings.HasPrefix(prefix, "*.") {
+		return dockerparser.Parse(location + strings.TrimPrefix(repository, ref.Registry()) + suffix.Of(ref))
+	}
+
+	return dockerparser.Parse(location + strings.TrimPrefix(repository, prefix) + suffix.Of(ref))
+}
@@ -0,0 +1,323 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package sysregistries
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/novln/docker-parser/internal/reftest"
+	"github.com/stretchr/testify/require"
+)
+
+const testDigest = "sha256:bc8813ea7b3603864987522f02a76101c17ad122e1c46d790efc0fca78ca7bfb"
+
+func load(is *require.Assertions) *Config {
+	config, err := LoadFile(filepath.Join("testdata", "registries.conf"))
+	is.NoError(err)
+	return config
+}
+
+func TestLoad(t *testing.T) {
+
+	is := require.New(t)
+
+	config := load(is)
+	is.Equal(ShortNamePermissive, config.ShortNameMode)
+	is.Len(config.UnqualifiedSearchRegistries, 4)
+	is.Len(config.Registries, 5)
+	is.Equal("docker.io", config.Registries[0].Prefix)
+	is.Len(config.Registries[0].Mirrors, 2)
+	is.True(config.Registries[0].Mirrors[0].Insecure)
+
+	invalid := []string{
+		`short-name-mode = "strict"`,
+		`unqualified-search-registries = ["quay.io/foo"]`,
+		"[[registry]]\ninsecure = true",
+		"[[registry]]\nprefix = \"foo.*.com\"",
+		"[[registry]]\nprefix = \"*.example.com\"\nlocation = \"example.com\"",
+		"[[registry]]\nlocation = \"quay.io\"\n[[registry]]\nprefix = \"quay.io\"",
+		"[[registry]]\nlocation = \"quay.io\"\n[[registry.mirror]]\ninsecure = true",
+		"[[registry]]\nlocation = \"quay.io\"\n[[registry.mirror]]\nlocation = \"m.io\"\npull-from-mirror = \"never\"",
+		"[registry]\nlocation = 42",
+	}
+
+	for _, s := range invalid {
+		config, err := Load(strings.NewReader(s))
+		is.Error(err, "an error was expected for %s", s)
+		is.Nil(config)
+	}
+
+}
+
+func TestSources(t *testing.T) {
+
+	is := require.New(t)
+
+	config := load(is)
+
+	tests := map[string][]Source{
+		"nginx:1.25": {
+			{Reference: reftest.Parse(t, "mirror.local:5000/dockerhub/library/nginx:1.25"), Insecure: true, Mirror: true},
+			{Reference: reftest.Parse(t, "docker.io/library/nginx:1.25")},
+		},
+		"nginx@" + testDigest: {
+			{Reference: reftest.Parse(t, "mirror.local:5000/dockerhub/library/nginx@"+testDigest), Insecure: true, Mirror: true},
+			{Reference: reftest.Parse(t, "mirror.example.com/docker/library/nginx@"+testDigest), Mirror: true},
+			{Reference: reftest.Parse(t, "docker.io/library/nginx@"+testDigest)},
+		},
+		"busybox": {
+			{Reference: reftest.Parse(t, "quay.io/prometheus/busybox:latest")},
+		},
+		"example.com/foo/app:1.0": {
+			{Reference: reftest.Parse(t, "internal.example.com/bar/foo/app:1.0"), Insecure: true},
+		},
+		"example.com/foo/app@" + testDigest: {
+			{Reference: reftest.Parse(t, "cache.example.com/foo/app@"+testDigest), Mirror: true},
+			{Reference: reftest.Parse(t, "internal.example.com/bar/foo/app@"+testDigest), Insecure: true},
+		},
+		"example.com/foobar/app:1.0": {
+			{Reference: reftest.Parse(t, "example.com/foobar/app:1.0")},
+		},
+		"registry.corp.example.com/team/app:1.0": {
+			{Reference: reftest.Parse(t, "mirror.corp.example.com/team/app:1.0"), Mirror: true},
+			{Reference: reftest.Parse(t, "registry.corp.example.com/team/app:1.0")},
+		},
+		"registry.corp.example.com:5000/team/app:1.0": {
+			{Reference: reftest.Parse(t, "mirror.corp.example.com/team/app:1.0"), Mirror: true},
+			{Reference: reftest.Parse(t, "registry.corp.example.com:5000/team/app:1.0")},
+		},
+		"registry.corp.example.com/team/app@" + testDigest: {
+			{Reference: reftest.Parse(t, "registry.corp.example.com/team/app@"+testDigest)},
+		},
+	}
+
+	for remote, expected := range tests {
+		sources, err := config.Sources(reftest.Parse(t, remote))
+		is.NoError(err, "sources error was not expected for %s", remote)
+		is.Equal(len(expected), len(sources), "unexpected sources for %s", remote)
+		for i := range expected {
+			is.Equal(expected[i].Reference.Remote(), sources[i].Reference.Remote())
+			is.Equal(expected[i].Insecure, sources[i].Insecure)
+			is.Equal(expected[i].Mirror, sources[i].Mirror)
+		}
+	}
+
+	sources, err := config.Sources(reftest.Parse(t, "blocked.example.com/app"))
+	is.Error(err)
+	is.Contains(err.Error(), ErrBlocked.Error())
+	is.Nil(sources)
+
+}
+
+func TestCandidates(t *testing.T) {
+
+	is := require.New(t)
+
+	config := load(is)
+
+	candidates, err := config.Candidates(reftest.Parse(t, "nginx:1.25"))
+	is.NoError(err)
+	remotes := []string{}
+	for _, candidate := range candidates {
+		remotes = append(remotes, candidate.Remote())
+	}
+	is.Equal([]string{
+		"registry.fedoraproject.org/nginx:1.25",
+		"quay.io/nginx:1.25",
+		"docker.io/library/nginx:1.25",
+	}, remotes)
+
+	candidates, err = config.Candidates(reftest.Parse(t, "library/nginx"))
+	is.NoError(err)
+	remotes = []string{}
+	for _, candidate := range candidates {
+		remotes = append(remotes, candidate.Remote())
+		is.True(candidate.HasImplicitTag(), "an implicit tag was expected for %s", candidate.Remote())
+	}
+	is.Equal([]string{
+		"registry.fedoraproject.org/library/nginx:latest",
+		"quay.io/library/nginx:latest",
+		"docker.io/library/nginx:latest",
+	}, remotes)
+
+	candidates, err = config.Candidates(reftest.Parse(t, "team/app@"+testDigest))
+	is.NoError(err)
+	is.Len(candidates, 3)
+	is.Equal("quay.io/team/app@"+testDigest, candidates[1].Remote())
+
+	candidates, err = config.Candidates(reftest.Parse(t, "docker.io/nginx"))
+	is.NoError(err)
+	is.Len(candidates, 1)
+	is.Equal("docker.io/library/nginx:latest", candidates[0].Remote())
+
+	config.ShortNameMode = ShortNameEnforcing
+	candidates, err = config.Candidates(reftest.Parse(t, "nginx"))
+	is.Equal(ErrAmbiguousShortName, err)
+	is.Len(candidates, 3)
+
+	config.UnqualifiedSearchRegistries = []string{"quay.io"}
+	candidates, err = config.Candidates(reftest.Parse(t, "nginx"))
+	is.NoError(err)
+	is.Len(candidates, 1)
+	is.Equal("quay.io/nginx:latest", candidates[0].Remote())
+
+	config.UnqualifiedSearchRegistries = nil
+	candidates, err = config.Candidates(reftest.Parse(t, "nginx"))
+	is.Equal(ErrNoSearchRegistries, err)
+	is.Nil(candidates)
+
+}
+
+func TestAliases(t *testing.T) {
+
+	is := require.New(t)
+
+	config := load(is)
+	is.NoError(config.LoadDropIns(filepath.Join("testdata", "registries.conf.d")))
+	is.NoError(config.LoadDropIns(filepath.Join("testdata", "missing.d")))
+
+	is.Equal([]string{"quay.io", "docker.io"}, config.UnqualifiedSearchRegistries)
+	is.Equal(ShortNamePermissive, config.ShortNameMode)
+	is.Len(config.Registries, 5)
+	is.Equal("registry.local/foo", config.FindRegistry(reftest.Parse(t, "example.com/foo/app")).Location)
+	is.Len(config.Aliases, 4)
+
+	tests := map[string]string{
+		"nginx:1.25":           "docker.io/library/nginx:1.25",
+		"fedora@" + testDigest: "registry.fedoraproject.org/fedora@" + testDigest,
+		"centos/centos:8":      "quay.io/centos/centos:8",
+		"busybox":              "quay.io/prometheus/busybox:latest",
+		"docker.io/fedora":     "docker.io/library/fedora:latest",
+	}
+
+	for remote, expected := range tests {
+		candidates, err := config.Parse(remote)
+		is.NoError(err, "parse error was not expected for %s", remote)
+		is.Len(candidates, 1, "a single candidate was expected for %s", remote)
+		is.Equal(expected, candidates[0].Remote())
+	}
+
+	candidates, err := config.Parse("alpine")
+	is.NoError(err)
+	is.Len(candidates, 2)
+	is.Equal("quay.io/alpine:latest", candidates[0].Remote())
+
+	candidates, err = config.Parse("library/nginx")
+	is.NoError(err)
+	is.Len(candidates, 2)
+	is.Equal("quay.io/library/nginx:latest", candidates[0].Remote())
+	is.Equal("docker.io/library/nginx:latest", candidates[1].Remote())
+
+	config.ShortNameMode = ShortNameDisabled
+	candidates, err = config.Parse("nginx")
+	is.NoError(err)
+	is.Len(candidates, 2)
+
+	candidates, err = config.Parse("Invalid")
+	is.Error(err)
+	is.Nil(candidates)
+
+	for _, s := range []string{
+		"[aliases]\n\"nginx:latest\" = \"docker.io/library/nginx\"",
+		"[aliases]\n\"docker.io/nginx\" = \"docker.io/library/nginx\"",
+		"[aliases]\n\"nginx\" = \"nginx\"",
+		"[aliases]\n\"nginx\" = \"docker.io/library/nginx@" + testDigest + "\"",
+	} {
+		config, err := Load(strings.NewReader(s))
+		is.Error(err, "an error was expected for %s", s)
+		is.Nil(config)
+	}
+
+}
+
+func TestRecordAlias(t *testing.T) {
+
+	is := require.New(t)
+
+	dir, err := ioutil.TempDir("", "sysregistries")
+	is.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "containers", "short-name-aliases.conf")
+
+	config := &Config{UnqualifiedSearchRegistries: []string{"quay.io", "docker.io"}}
+	is.NoError(config.RecordAlias(path, "nginx", reftest.Parse(t, "docker.io/library/nginx:1.25")))
+	is.NoError(config.RecordAlias(path, "team/app", reftest.Parse(t, "registry.local:5000/team/app")))
+	is.NoError(config.RecordAlias(path, "nginx", reftest.Parse(t, "quay.io/nginx/nginx")))
+
+	is.Error(config.RecordAlias(path, "docker.io/nginx", reftest.Parse(t, "quay.io/nginx/nginx")))
+	is.Error(config.RecordAlias(path, "nginx:1.25", reftest.Parse(t, "quay.io/nginx/nginx")))
+	is.Error(config.RecordAlias(path, "nginx", reftest.Parse(t, "nginx")))
+
+	candidates, err := config.Parse("nginx:1.25")
+	is.NoError(err)
+	is.Len(candidates, 1)
+	is.Equal("quay.io/nginx/nginx:1.25", candidates[0].Remote())
+
+	reloaded := &Config{}
+	is.NoError(reloaded.LoadAliases(path))
+	is.Equal(map[string]string{
+		"nginx":    "quay.io/nginx/nginx",
+		"team/app": "registry.local:5000/team/app",
+	}, reloaded.Aliases)
+
+	is.True(os.IsNotExist(reloaded.LoadAliases(filepath.Join(dir, "missing.conf"))))
+
+	is.NoError(ioutil.WriteFile(path, []byte("[aliases]\nnginx = 42\n"), 0600))
+	is.Error(reloaded.LoadAliases(path))
+
+}
+
+func TestAliasPrecedence(t *testing.T) {
+
+	is := require.New(t)
+
+	dir, err := ioutil.TempDir("", "sysregistries")
+	is.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "short-name-aliases.conf")
+
+	cache := "[aliases]\n" +
+		"nginx = \"quay.io/nginx/nginx\"\n" +
+		"\"library/nginx\" = \"quay.io/nginx/nginx\"\n" +
+		"\"team/app\" = \"registry.local:5000/team/app\"\n"
+	is.NoError(ioutil.WriteFile(path, []byte(cache), 0600))
+
+	config, err := Load(strings.NewReader("[aliases]\nnginx = \"docker.io/library/nginx\"\n"))
+	is.NoError(err)
+	is.NoError(config.LoadAliases(path))
+
+	is.Equal(map[string]string{
+		"nginx":         "docker.io/library/nginx",
+		"library/nginx": "quay.io/nginx/nginx",
+		"team/app":      "registry.local:5000/team/app",
+	}, config.Aliases)
+
+	candidates, err := config.Parse("nginx:1.25")
+	is.NoError(err)
+	is.Len(candidates, 1)
+	is.Equal("docker.io/library/nginx:1.25", candidates[0].Remote())
+
+	candidates, err = config.Parse("library/nginx:1.25")
+	is.NoError(err)
+	is.Len(candidates, 1)
+	is.Equal("quay.io/nginx/nginx:1.25", candidates[0].Remote())
+
+}
@@ -0,0 +1,310 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package update selects the best upgrade of an image reference among a list of available tags,
+// following a strategy: semantic versions, date-stamped tags, regular expressions or digest changes.
+//
+// It doesn't use the network: tags, and digests if needed, must be supplied by the caller.
+package update
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/distribution/digest"
+	"github.com/novln/docker-parser/version"
+)
+
+// ErrDigestReference is returned when a strategy requires a tagged reference and is given a digest.
+var ErrDigestReference = errors.New("reference uses a digest instead of a tag")
+
+// Candidate is an upgrade of a reference.
+type Candidate struct {
+	// Reference is the upgraded reference.
+	Reference *dockerparser.Reference
+	// Tag is the tag of the upgraded reference.
+	Tag string
+	// Digest is the digest of the upgraded reference, if known.
+	Digest digest.Digest
+	// Reason explains why the candidate was selected.
+	Reason string
+}
+
+// Strategy selects the best upgrade of a reference among the given tags.
+// It returns a nil Candidate if the reference is already up to date.
+type Strategy interface {
+	Select(current *dockerparser.Reference, tags []string) (*Candidate, error)
+}
+
+// Select returns the best upgrade of current among the given tags, using the given strategy.
+// It returns a nil Candidate if current is already up to date.
+func Select(current *dockerparser.Reference, tags []string, strategy Strategy) (*Candidate, error) {
+	return strategy.Select(current, tags)
+}
+
+// Level is the highest version segment a Semver strategy is allowed to change.
+type Level int
+
+const (
+	// Patch allows updates within the same minor version, such as 1.2.3 to 1.2.9.
+	Patch Level = iota
+	// Minor allows updates within the same major version, such as 1.2.3 to 1.9.0.
+	Minor
+	// Major allows any update, such as 1.2.3 to 3.0.0.
+	Major
+)
+
+func (l Level) String() string {
+	switch l {
+	case Patch:
+		return "patch"
+	case Minor:
+		return "minor"
+	default:
+		return "major"
+	}
+}
+
+// pinned returns the number of leading segments that can't change at this level: none for Major,
+// the major version for Minor, and the major and minor versions for Patch.
+func (l Level) pinned() int {
+	return int(Major - l)
+}
+
+// Semver selects the greatest version with the same prefix, number of segments and variant as the
+// current tag, up to the given level. Pre-releases are ignored unless the current tag is one, or
+// AllowPreRelease is true.
+type Semver struct {
+	Level           Level
+	AllowPreRelease bool
+}
+
+// Select implements Strategy.
+func (s Semver) Select(current *dockerparser.Reference, tags []string) (*Candidate, error) {
+
+	if current.HasDigest() {
+		return nil, ErrDigestReference
+	}
+
+	base, err := version.Parse(current.Tag())
+	if err != nil {
+		return nil, fmt.Errorf("current tag %s: %s", current.Tag(), err)
+	}
+
+	var best *version.Version
+
+	for _, tag := range tags {
+		v, err := version.Parse(tag)
+		if err != nil || v.Prefix != base.Prefix || v.Variant != base.Variant || len(v.Segments) != len(base.Segments) {
+			continue
+		}
+		if v.IsPreRelease() && !base.IsPreRelease() && !s.AllowPreRelease {
+			continue
+		}
+		if !sameSegments(v, base, s.Level.pinned()) {
+			continue
+		}
+		if version.Compare(v, base) <= 0 {
+			continue
+		}
+		if best == nil || version.Compare(v, best) > 0 {
+			best = v
+		}
+	}
+
+	if best == nil {
+		return nil, nil
+	}
+
+	return newCandidate(current, best.Tag, fmt.Sprintf("%s is the latest %s update of %s", best.Tag, s.Level, base.Tag))
+}
+
+// sameSegments returns true if the first n segments of a and b are equal.
+func sameSegments(a, b *version.Version, n int) bool {
+	for i := 0; i < n; i++ {
+		if a.Segment(i) != b.Segment(i) {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	dateRegexp   = regexp.MustCompile(`(?:19|20)[0-9]{2}-?(?:0[1-9]|1[0-2])-?(?:0[1-9]|[12][0-9]|3[01])`)
+	numberRegexp = regexp.MustCompile(`[0-9]+`)
+)
+
+// DateStamp selects the newest date-stamped tag, such as 20201106 or nightly-2020-11-06-1.
+// Candidates must have the same layout as the current tag, where only numbers differ, and are
+// ordered by comparing their numbers from left to right.
+type DateStamp struct{}
+
+// Select implements Strategy.
+func (DateStamp) Select(current *dockerparser.Reference, tags []string) (*Candidate, error) {
+
+	if current.HasDigest() {
+		return nil, ErrDigestReference
+	}
+
+	base := current.Tag()
+	if !dateRegexp.MatchString(base) {
+		return nil, fmt.Errorf("current tag %s is not date-stamped", base)
+	}
+	layout := numberRegexp.ReplaceAllString(base, "#")
+
+	best := base
+	for _, tag := range tags {
+		if numberRegexp.ReplaceAllString(tag, "#") != layout || !dateRegexp.MatchString(tag) {
+			continue
+		}
+		if compareValues(numberRegexp.FindAllString(tag, -1), numberRegexp.FindAllString(best, -1)) > 0 {
+			best = tag
+		}
+	}
+
+	if best == base {
+		return nil, nil
+	}
+
+	return newCandidate(current, best, fmt.Sprintf("%s is the newest date-stamped tag after %s", best, base))
+}
+
+// Regexp selects the greatest tag matching the given regular expression, by comparing its capture
+// groups in order: numerically if both values are numbers, lexically otherwise.
+type Regexp struct {
+	Pattern *regexp.Regexp
+}
+
+// Select implements Strategy.
+func (s Regexp) Select(current *dockerparser.Reference, tags []string) (*Candidate, error) {
+
+	if current.HasDigest() {
+		return nil, ErrDigestReference
+	}
+	if s.Pattern.NumSubexp() == 0 {
+		return nil, fmt.Errorf("pattern %s has no capture group", s.Pattern)
+	}
+
+	base := s.Pattern.FindStringSubmatch(current.Tag())
+	if base == nil {
+		return nil, fmt.Errorf("current tag %s doesn't match %s", current.Tag(), s.Pattern)
+	}
+
+	best, values := "", base[1:]
+	for _, tag := range tags {
+		m := s.Pattern.FindStringSubmatch(tag)
+		if m == nil {
+			continue
+		}
+		if _, err := current.WithTag(tag); err != nil {
+			continue
+		}
+		if compareValues(m[1:], values) > 0 {
+			best, values = tag, m[1:]
+		}
+	}
+
+	if best == "" {
+		return nil, nil
+	}
+
+	return newCandidate(current, best, fmt.Sprintf("%s is the greatest tag matching %s", best, s.Pattern))
+}
+
+// compareValues compares capture groups in order, numerically if both values are numbers.
+func compareValues(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		x, xerr := strconv.ParseUint(a[i], 10, 64)
+		y, yerr := strconv.ParseUint(b[i], 10, 64)
+		switch {
+		case xerr == nil && yerr == nil && x < y:
+			return -1
+		case xerr == nil && yerr == nil && x > y:
+			return 1
+		case xerr != nil || yerr != nil:
+			if c := strings.Compare(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+// DigestChange detects that a mutable tag, such as latest or 1.25, now points to a new manifest.
+// Current is the digest currently deployed for the tag, and Digests maps available tags to their
+// digest. The candidate is the current reference pinned to the new digest.
+type DigestChange struct {
+	Current digest.Digest
+	Digests map[string]digest.Digest
+}
+
+// Select implements Strategy.
+func (s DigestChange) Select(current *dockerparser.Reference, tags []string) (*Candidate, error) {
+
+	if current.HasDigest() {
+		return nil, ErrDigestReference
+	}
+
+	tag := current.Tag()
+	found := false
+	for _, t := range tags {
+		if t == tag {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("tag %s is not available", tag)
+	}
+
+	latest, ok := s.Digests[tag]
+	if !ok {
+		return nil, fmt.Errorf("digest of tag %s is unknown", tag)
+	}
+	if latest == s.Current {
+		return nil, nil
+	}
+
+	reference, err := current.WithDigest(latest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Candidate{
+		Reference: reference,
+		Tag:       tag,
+		Digest:    latest,
+		Reason:    fmt.Sprintf("tag %s now points to %s instead of %s", tag, latest, s.Current),
+	}, nil
+}
+
+func newCandidate(current *dockerparser.Reference, tag, reason string) (*Candidate, error) {
+
+	reference, err := current.WithTag(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Candidate{
+		Reference: reference,
+		Tag:       tag,
+		Reason:    reason,
+	}, nil
+}
@@ -0,0 +1,205 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package update
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	dockerparser "github.com/novln/docker-parser"
+	"github.com/novln/docker-parser/distribution/digest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSemver(t *testing.T) {
+
+	is := require.New(t)
+
+	tags := []string{
+		"latest", "1.24.0", "1.25.2", "1.25.3", "1.25.4-alpine", "1.26.0-rc.1", "1.26.0", "1.27.1",
+		"2.0.0", "v3.0.0", "1.25", "2.1.0-rc.1", "1.26", "2.0", "1.26-alpine", "2.1-alpine",
+	}
+
+	tests := []struct {
+		current  string
+		strategy Semver
+		expected string
+	}{
+		{"nginx:1.25.2", Semver{Level: Patch}, "1.25.3"},
+		{"nginx:1.25.2", Semver{Level: Minor}, "1.27.1"},
+		{"nginx:1.25.2", Semver{Level: Major}, "2.0.0"},
+		{"nginx:1.25.2", Semver{Level: Major, AllowPreRelease: true}, "2.1.0-rc.1"},
+		{"nginx:1.25.3", Semver{Level: Patch}, ""},
+		{"nginx:1.25.3-alpine", Semver{Level: Patch}, "1.25.4-alpine"},
+		{"nginx:1.26.0-rc.1", Semver{Level: Patch}, "1.26.0"},
+		{"nginx:1.24", Semver{Level: Minor}, "1.26"},
+		{"nginx:1.25", Semver{Level: Minor}, "1.26"},
+		{"nginx:1.25", Semver{Level: Major}, "2.0"},
+		{"nginx:1.25", Semver{Level: Patch}, ""},
+		{"nginx:1.25-alpine", Semver{Level: Minor}, "1.26-alpine"},
+		{"nginx:1.25-alpine", Semver{Level: Major}, "2.1-alpine"},
+		{"nginx:2.0.0", Semver{Level: Major}, ""},
+	}
+
+	for _, test := range tests {
+		current, err := dockerparser.Parse(test.current)
+		is.NoError(err)
+
+		c, err := Select(current, tags, test.strategy)
+		is.NoError(err, "select error was not expected for %s", test.current)
+
+		if test.expected == "" {
+			is.Nil(c, "no candidate was expected for %s", test.current)
+			continue
+		}
+		is.NotNil(c, "a candidate was expected for %s", test.current)
+		is.Equal(test.expected, c.Tag)
+		is.Equal("docker.io/library/nginx:"+test.expected, c.Reference.Remote())
+		is.NotEmpty(c.Reason)
+	}
+
+	current, err := dockerparser.Parse("nginx:latest")
+	is.NoError(err)
+	c, err := Select(current, tags, Semver{Level: Major})
+	is.Error(err)
+	is.Nil(c)
+
+}
+
+func TestDateStamp(t *testing.T) {
+
+	is := require.New(t)
+
+	tags := []string{
+		"latest", "20201106", "20210110", "20201231", "nightly-2020-11-06-1", "nightly-2020-11-06-2",
+		"nightly-2020-11-07-1", "nightly-2021-01-01", "99999999",
+	}
+
+	current, err := dockerparser.Parse("gcr.io/project/app:20201106")
+	is.NoError(err)
+	c, err := Select(current, tags, DateStamp{})
+	is.NoError(err)
+	is.NotNil(c)
+	is.Equal("20210110", c.Tag)
+	is.Equal("gcr.io/project/app:20210110", c.Reference.Remote())
+	is.NotEmpty(c.Reason)
+
+	current, err = dockerparser.Parse("gcr.io/project/app:nightly-2020-11-06-1")
+	is.NoError(err)
+	c, err = Select(current, tags, DateStamp{})
+	is.NoError(err)
+	is.NotNil(c)
+	is.Equal("nightly-2020-11-07-1", c.Tag)
+
+	current, err = dockerparser.Parse("gcr.io/project/app:20210110")
+	is.NoError(err)
+	c, err = Select(current, tags, DateStamp{})
+	is.NoError(err)
+	is.Nil(c)
+
+	current, err = dockerparser.Parse("gcr.io/project/app:1.2.3")
+	is.NoError(err)
+	c, err = Select(current, tags, DateStamp{})
+	is.Error(err)
+	is.Nil(c)
+
+}
+
+func TestRegexp(t *testing.T) {
+
+	is := require.New(t)
+
+	strategy := Regexp{Pattern: regexp.MustCompile(`^release-([0-9]+)-build([0-9]+)$`)}
+	tags := []string{"latest", "release-9-build30", "release-10-build2", "release-10-build11", "release-10-build9-dirty"}
+
+	current, err := dockerparser.Parse("registry.local:5000/team/app:release-9-build30")
+	is.NoError(err)
+	c, err := Select(current, tags, strategy)
+	is.NoError(err)
+	is.NotNil(c)
+	is.Equal("release-10-build11", c.Tag)
+	is.Equal("registry.local:5000/team/app:release-10-build11", c.Reference.Remote())
+	is.NotEmpty(c.Reason)
+
+	current, err = dockerparser.Parse("registry.local:5000/team/app:release-10-build11")
+	is.NoError(err)
+	c, err = Select(current, tags, strategy)
+	is.NoError(err)
+	is.Nil(c)
+
+	current, err = dockerparser.Parse("registry.local:5000/team/app:latest")
+	is.NoError(err)
+	c, err = Select(current, tags, strategy)
+	is.Error(err)
+	is.Nil(c)
+
+	c, err = Select(current, tags, Regexp{Pattern: regexp.MustCompile(`^latest$`)})
+	is.Error(err)
+	is.Nil(c)
+
+	current, err = dockerparser.Parse("registry.local:5000/team/app:v1")
+	is.NoError(err)
+	c, err = Select(current, []string{"v1", "v2", "v3/invalid", "v4:invalid"}, Regexp{Pattern: regexp.MustCompile(`^v([0-9]+)`)})
+	is.NoError(err)
+	is.NotNil(c)
+	is.Equal("v2", c.Tag)
+
+}
+
+func TestDigestChange(t *testing.T) {
+
+	is := require.New(t)
+
+	previous := digest.Digest("sha256:" + strings.Repeat("a", 64))
+	latest := digest.Digest("sha256:" + strings.Repeat("b", 64))
+
+	strategy := DigestChange{
+		Current: previous,
+		Digests: map[string]digest.Digest{"latest": latest, "1.25": previous},
+	}
+	tags := []string{"latest", "1.25"}
+
+	current, err := dockerparser.Parse("nginx")
+	is.NoError(err)
+	c, err := Select(current, tags, strategy)
+	is.NoError(err)
+	is.NotNil(c)
+	is.Equal("latest", c.Tag)
+	is.Equal(latest, c.Digest)
+	is.Equal("docker.io/library/nginx@"+string(latest), c.Reference.Remote())
+	is.NotEmpty(c.Reason)
+
+	current, err = dockerparser.Parse("nginx:1.25")
+	is.NoError(err)
+	c, err = Select(current, tags, strategy)
+	is.NoError(err)
+	is.Nil(c)
+
+	current, err = dockerparser.Parse("nginx:1.26")
+	is.NoError(err)
+	c, err = Select(current, tags, strategy)
+	is.Error(err)
+	is.Nil(c)
+
+	current, err = dockerparser.Parse("nginx@" + string(previous))
+	is.NoError(err)
+	c, err = Select(current, tags, strategy)
+	is.Equal(ErrDigestReference, err)
+	is.Nil(c)
+
+}
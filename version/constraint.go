@@ -0,0 +1,291 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package version
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Constraint restricts the versions to consider, such as ~1.25, ^2.1, >=1.2 <2 or 3.x || 4.x.
+//
+// Comparators separated by spaces or commas must all be satisfied, and alternatives are separated
+// by "||". The supported comparators are:
+//
+// 	=1.2, !=1.2, >1.2, >=1.2, <1.2, <=1.2
+// 	1.2, 1.2.x, 1.2.*  any version starting with 1.2 (>=1.2 <1.3)
+// 	~1.2, ~1.2.3       same minor version (>=1.2 <1.3, >=1.2.3 <1.3)
+// 	^1.2.3, ^0.2.3     same left-most non-zero segment (>=1.2.3 <2, >=0.2.3 <0.3)
+// 	*                  any version
+//
+// Wildcards can't be excluded with !=: !=1.2.x must be written <1.2 || >=1.3.
+//
+// Pre-releases are only allowed if a comparator of the same alternative has a pre-release with the
+// same segments, such as >=1.2.3-rc.1 for 1.2.3-rc.2.
+type Constraint struct {
+	raw          string
+	alternatives [][]comparator
+}
+
+type comparator struct {
+	operator   string
+	segments   []int
+	preRelease string
+}
+
+// ParseConstraint returns a Constraint from analyzing the given string.
+func ParseConstraint(s string) (*Constraint, error) {
+
+	c := &Constraint{raw: s}
+
+	for _, alternative := range strings.Split(s, "||") {
+		comparators := []comparator{}
+		fields := strings.FieldsFunc(alternative, func(r rune) bool {
+			return r == ' ' || r == ',' || r == '\t'
+		})
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid constraint %q: empty alternative", s)
+		}
+		for _, field := range fields {
+			expanded, err := parseComparator(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid constraint %q: %s", s, err)
+			}
+			comparators = append(comparators, expanded...)
+		}
+		c.alternatives = append(c.alternatives, comparators)
+	}
+
+	return c, nil
+}
+
+// MustParseConstraint is like ParseConstraint but panics if the constraint can't be parsed.
+func MustParseConstraint(s string) *Constraint {
+	c, err := ParseConstraint(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func (c Constraint) String() string {
+	return c.raw
+}
+
+// Check returns true if the version satisfies the constraint.
+func (c Constraint) Check(v *Version) bool {
+	for _, comparators := range c.alternatives {
+		if check(comparators, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func check(comparators []comparator, v *Version) bool {
+
+	allowed := !v.IsPreRelease()
+
+	for _, c := range comparators {
+		cmp := compareSegments(v.Segments, c.segments)
+		if cmp == 0 && c.preRelease != "" && v.IsPreRelease() {
+			allowed = true
+		}
+		if cmp == 0 {
+			cmp = comparePreRelease(v.PreRelease, c.preRelease)
+		}
+
+		var ok bool
+		switch c.operator {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return allowed
+}
+
+// parseComparator expands a comparator into primitive ones, using only =, !=, >, >=, < and <=.
+func parseComparator(s string) ([]comparator, error) {
+
+	operator := ""
+	for _, op := range []string{">=", "<=", "!=", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(s, op) {
+			operator, s = op, s[len(op):]
+			break
+		}
+	}
+
+	segments, preRelease, wildcard, err := parseRange(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(segments) == 0 {
+		switch operator {
+		case "", "=", ">=", "<=", "~", "^":
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("%q matches nothing", operator+s)
+		}
+	}
+
+	if operator == "!=" && wildcard {
+		// !=1.2.x would be <1.2 || >=1.3, which can't be expressed in a single alternative.
+		return nil, fmt.Errorf("%q is not supported, use alternatives with < and >= instead", operator+s)
+	}
+
+	lower := comparator{operator: ">=", segments: segments, preRelease: preRelease}
+
+	switch operator {
+	case "", "=":
+		if operator == "=" && !wildcard {
+			return []comparator{{operator: "=", segments: segments, preRelease: preRelease}}, nil
+		}
+		return []comparator{lower, {operator: "<", segments: increment(segments, len(segments)-1)}}, nil
+	case "~":
+		i := 1
+		if len(segments) == 1 {
+			i = 0
+		}
+		return []comparator{lower, {operator: "<", segments: increment(segments, i)}}, nil
+	case "^":
+		i := 0
+		for i < len(segments)-1 && segments[i] == 0 {
+			i++
+		}
+		return []comparator{lower, {operator: "<", segments: increment(segments, i)}}, nil
+	case ">", "<=":
+		if wildcard {
+			// >1.2.x is >=1.3, and <=1.2.x is <1.3.
+			next := comparator{operator: ">=", segments: increment(segments, len(segments)-1)}
+			if operator == "<=" {
+				next.operator = "<"
+			}
+			return []comparator{next}, nil
+		}
+	}
+
+	return []comparator{{operator: operator, segments: segments, preRelease: preRelease}}, nil
+}
+
+// parseRange parses a version of a constraint, which may end with a wildcard segment.
+func parseRange(s string) ([]int, string, bool, error) {
+
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	if s == "" {
+		return nil, "", false, fmt.Errorf("missing version")
+	}
+
+	numbers, preRelease := s, ""
+	if i := strings.IndexByte(s, '-'); i != -1 {
+		numbers, preRelease = s[:i], s[i+1:]
+	}
+
+	segments := []int{}
+	wildcard := false
+	for _, segment := range strings.Split(numbers, ".") {
+		if segment == "x" || segment == "X" || segment == "*" {
+			wildcard = true
+			continue
+		}
+		n, err := strconv.Atoi(segment)
+		if err != nil || n < 0 || wildcard {
+			return nil, "", false, fmt.Errorf("invalid version %q", s)
+		}
+		segments = append(segments, n)
+	}
+
+	if wildcard && preRelease != "" {
+		return nil, "", false, fmt.Errorf("invalid version %q", s)
+	}
+
+	return segments, preRelease, wildcard, nil
+}
+
+// increment returns the segments up to i, with the i-th one incremented.
+func increment(segments []int, i int) []int {
+	next := make([]int, i+1)
+	copy(next, segments[:i+1])
+	next[i]++
+	return next
+}
+
+// compareSegments compares segments numerically, missing segments being zero.
+func compareSegments(a, b []int) int {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		x, y := 0, 0
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if c := compareInt(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// Sort sorts versions in increasing order.
+func Sort(versions []*Version) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return Compare(versions[i], versions[j]) < 0
+	})
+}
+
+// Latest returns the greatest version among the given tags that has the given variant and satisfies
+// the constraint, which may be nil to accept any version. Tags that aren't versions are ignored.
+func Latest(tags []string, constraint *Constraint, variant string) (*Version, bool) {
+
+	var latest *Version
+
+	for _, tag := range tags {
+		v, err := Parse(tag)
+		if err != nil || v.Variant != variant {
+			continue
+		}
+		if constraint != nil && !constraint.Check(v) {
+			continue
+		}
+		if latest == nil || Compare(v, latest) > 0 {
+			latest = v
+		}
+	}
+
+	return latest, latest != nil
+}
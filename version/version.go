@@ -0,0 +1,220 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+// Package version interprets image tags as versions, such as 1.25.3, v2.1.0-rc.1, 3.19-alpine or
+// 1.2.3-debian-12-r4, in order to compare them and select the latest one satisfying a constraint.
+//
+// A tag is made of an optional "v" prefix, numeric segments separated by dots, and an optional
+// suffix introduced by a dash. The suffix starts with an optional pre-release (alpha, beta, rc...),
+// continues with a variant (alpine, debian-12...) and ends with an optional revision (r4).
+package version
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/novln/docker-parser/distribution/reference"
+)
+
+var (
+	// ErrTagInvalidFormat is returned when a string isn't a valid tag.
+	ErrTagInvalidFormat = reference.ErrTagInvalidFormat
+
+	// ErrNotVersion is returned when a tag doesn't start with a version, such as latest.
+	ErrNotVersion = errors.New("tag is not a version")
+)
+
+var (
+	anchoredTagRegexp  = regexp.MustCompile(`^` + reference.TagRegexp.String() + `$`)
+	preReleaseRegexp   = regexp.MustCompile(`^(?i:alpha|beta|rc|pre|preview|dev|snapshot|milestone|m)(?:\.?[0-9]+)?$`)
+	revisionRegexp     = regexp.MustCompile(`^r([0-9]+)$`)
+	numericPartsRegexp = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// Version is a tag interpreted as a version.
+type Version struct {
+	// Tag is the tag the version was parsed from.
+	Tag string
+	// Prefix is the "v" prefix of the tag, if any.
+	Prefix string
+	// Segments are the numeric segments of the version, such as [1 25 3].
+	Segments []int
+	// PreRelease is the pre-release identifier, such as rc.1.
+	PreRelease string
+	// Variant is the variant suffix, such as alpine or debian-12.
+	Variant string
+	// Revision is the revision number of the image, such as 4 for r4, or -1 if there is none.
+	Revision int
+}
+
+// Parse interprets the given tag as a version.
+func Parse(tag string) (*Version, error) {
+
+	if !anchoredTagRegexp.MatchString(tag) {
+		return nil, ErrTagInvalidFormat
+	}
+
+	v := &Version{Tag: tag, Revision: -1}
+	s := tag
+
+	if s[0] == 'v' || s[0] == 'V' {
+		v.Prefix, s = s[:1], s[1:]
+	}
+
+	numbers, suffix := s, ""
+	if i := strings.IndexByte(s, '-'); i != -1 {
+		numbers, suffix = s[:i], s[i+1:]
+		if suffix == "" {
+			return nil, ErrNotVersion
+		}
+	}
+
+	for _, segment := range strings.Split(numbers, ".") {
+		if !numericPartsRegexp.MatchString(segment) {
+			return nil, ErrNotVersion
+		}
+		n, err := strconv.Atoi(segment)
+		if err != nil {
+			return nil, ErrNotVersion
+		}
+		v.Segments = append(v.Segments, n)
+	}
+
+	if suffix == "" {
+		return v, nil
+	}
+
+	parts := strings.Split(suffix, "-")
+	if preReleaseRegexp.MatchString(parts[0]) {
+		v.PreRelease, parts = parts[0], parts[1:]
+	}
+	if n := len(parts); n > 0 {
+		if m := revisionRegexp.FindStringSubmatch(parts[n-1]); m != nil {
+			v.Revision, _ = strconv.Atoi(m[1])
+			parts = parts[:n-1]
+		}
+	}
+	v.Variant = strings.Join(parts, "-")
+
+	return v, nil
+}
+
+// Segment returns the i-th numeric segment of the version, or 0 if it doesn't have one.
+func (v Version) Segment(i int) int {
+	if i < len(v.Segments) {
+		return v.Segments[i]
+	}
+	return 0
+}
+
+// IsPreRelease returns true if the version has a pre-release identifier.
+func (v Version) IsPreRelease() bool {
+	return v.PreRelease != ""
+}
+
+func (v Version) String() string {
+	return v.Tag
+}
+
+// Compare returns -1, 0 or 1 if a is respectively lower, equal or greater than b.
+//
+// Segments are compared numerically, missing segments being lower than zero ones (3.19 < 3.19.0).
+// A pre-release is lower than its release, and pre-releases are compared like semantic versions.
+// Finally, revisions are compared numerically. Variants and prefixes are ignored.
+func Compare(a, b *Version) int {
+
+	n := len(a.Segments)
+	if len(b.Segments) > n {
+		n = len(b.Segments)
+	}
+	for i := 0; i < n; i++ {
+		if c := compareInt(a.Segment(i), b.Segment(i)); c != 0 {
+			return c
+		}
+	}
+	if c := compareInt(len(a.Segments), len(b.Segments)); c != 0 {
+		return c
+	}
+
+	if c := comparePreRelease(a.PreRelease, b.PreRelease); c != 0 {
+		return c
+	}
+
+	return compareInt(a.Revision, b.Revision)
+}
+
+// comparePreRelease compares pre-release identifiers, where an empty one is a release.
+func comparePreRelease(a, b string) int {
+
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	x, y := splitIdentifiers(strings.ToLower(a)), splitIdentifiers(strings.ToLower(b))
+	for i := 0; i < len(x) && i < len(y); i++ {
+		xn, xerr := strconv.Atoi(x[i])
+		yn, yerr := strconv.Atoi(y[i])
+		switch {
+		case xerr == nil && yerr == nil:
+			if c := compareInt(xn, yn); c != 0 {
+				return c
+			}
+		case xerr == nil:
+			return -1
+		case yerr == nil:
+			return 1
+		default:
+			if c := strings.Compare(x[i], y[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	return compareInt(len(x), len(y))
+}
+
+// splitIdentifiers splits a pre-release into alphabetic and numeric identifiers: rc.1 and rc1 both
+// give [rc 1].
+func splitIdentifiers(s string) []string {
+	identifiers := []string{}
+	for _, part := range strings.Split(s, ".") {
+		i := strings.IndexAny(part, "0123456789")
+		if i > 0 {
+			identifiers = append(identifiers, part[:i], part[i:])
+		} else {
+			identifiers = append(identifiers, part)
+		}
+	}
+	return identifiers
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
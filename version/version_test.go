@@ -0,0 +1,175 @@
+//
+// Copyright (C) 2015-2017 Thomas LE ROUX <thomas@leroux.io>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+
+	is := require.New(t)
+
+	tests := map[string]Version{
+		"1.25.3":             {Segments: []int{1, 25, 3}, Revision: -1},
+		"v2.1.0-rc.1":        {Prefix: "v", Segments: []int{2, 1, 0}, PreRelease: "rc.1", Revision: -1},
+		"3.19-alpine":        {Segments: []int{3, 19}, Variant: "alpine", Revision: -1},
+		"1.2.3-debian-12-r4": {Segments: []int{1, 2, 3}, Variant: "debian-12", Revision: 4},
+		"2.0.0-beta2-alpine": {Segments: []int{2, 0, 0}, PreRelease: "beta2", Variant: "alpine", Revision: -1},
+		"20201106":           {Segments: []int{20201106}, Revision: -1},
+	}
+
+	for tag, expected := range tests {
+		v, err := Parse(tag)
+		is.NoError(err, "parse error was not expected for %s", tag)
+		expected.Tag = tag
+		is.Equal(expected, *v)
+		is.Equal(tag, v.String())
+	}
+
+	for _, tag := range []string{"latest", "alpine-3.12", "1.2.", "1.2-", "v", "-1.0", "1.2:3"} {
+		v, err := Parse(tag)
+		is.Error(err, "an error was expected for %s", tag)
+		is.Nil(v)
+	}
+
+}
+
+func TestCompare(t *testing.T) {
+
+	is := require.New(t)
+
+	ordered := []string{
+		"1.2",
+		"1.2.0-alpha",
+		"1.2.0-alpha.1",
+		"1.2.0-beta.2",
+		"1.2.0-beta.11",
+		"1.2.0-rc1",
+		"1.2.0",
+		"1.2.0-r1",
+		"1.2.0-r10",
+		"1.2.1",
+		"1.10.0",
+		"v2.0.0",
+	}
+
+	versions := []*Version{}
+	for i := len(ordered) - 1; i >= 0; i-- {
+		v, err := Parse(ordered[i])
+		is.NoError(err)
+		versions = append(versions, v)
+	}
+
+	Sort(versions)
+
+	for i, v := range versions {
+		is.Equal(ordered[i], v.Tag)
+		if i > 0 {
+			is.Equal(1, Compare(v, versions[i-1]))
+			is.Equal(-1, Compare(versions[i-1], v))
+		}
+		is.Equal(0, Compare(v, v))
+	}
+
+}
+
+func TestConstraint(t *testing.T) {
+
+	is := require.New(t)
+
+	tests := []struct {
+		constraint string
+		tag        string
+		expected   bool
+	}{
+		{"~1.25", "1.25.0", true},
+		{"~1.25", "1.25.9", true},
+		{"~1.25", "1.26.0", false},
+		{"~1.25", "1.24.9", false},
+		{"~1.25", "1.25.1-rc.1", false},
+		{"~1.25.3", "1.25.2", false},
+		{"~1.25.3", "1.25.4", true},
+		{"^1.2.3", "1.9.0", true},
+		{"^1.2.3", "2.0.0", false},
+		{"^0.2.3", "0.2.9", true},
+		{"^0.2.3", "0.3.0", false},
+		{"1.25", "1.25.3", true},
+		{"1.25.x", "1.26", false},
+		{">=1.2 <2", "1.99", true},
+		{">=1.2, <2", "2.0.0", false},
+		{">1.2.x", "1.2.9", false},
+		{">1.2.x", "1.3.0", true},
+		{"<=1.2.x", "1.2.9", true},
+		{"=1.2", "1.2.0", true},
+		{"=1.2", "1.2.1", false},
+		{"!=1.2.3", "1.2.3", false},
+		{"3.x || 5.x", "5.1", true},
+		{"3.x || 5.x", "4.1", false},
+		{"*", "42", true},
+		{">=2.1.0-rc.1", "2.1.0-rc.2", true},
+		{">=2.1.0-rc.1", "2.2.0-rc.1", false},
+		{">=2.1.0-rc.1", "2.1.0", true},
+	}
+
+	for _, test := range tests {
+		c, err := ParseConstraint(test.constraint)
+		is.NoError(err, "parse error was not expected for %s", test.constraint)
+		is.Equal(test.constraint, c.String())
+
+		v, err := Parse(test.tag)
+		is.NoError(err)
+
+		is.Equal(test.expected, c.Check(v), "unexpected check of %s with %s", test.tag, test.constraint)
+	}
+
+	for _, s := range []string{"", "1.2 ||", "~", ">foo", "1.x.2", "<*", "1.x-rc", "!=1.2.x", ">=1 !=2.*"} {
+		c, err := ParseConstraint(s)
+		is.Error(err, "an error was expected for %q", s)
+		is.Nil(c)
+	}
+
+}
+
+func TestLatest(t *testing.T) {
+
+	is := require.New(t)
+
+	tags := []string{
+		"latest", "alpine", "1.25", "1.25-alpine", "1.25.2", "1.25.3", "1.25.3-alpine", "1.25.4-alpine",
+		"1.26.0-rc.1", "1.26.0", "1.26.1-alpine", "mainline",
+	}
+
+	v, ok := Latest(tags, MustParseConstraint("~1.25"), "")
+	is.True(ok)
+	is.Equal("1.25.3", v.Tag)
+
+	v, ok = Latest(tags, MustParseConstraint("~1.25"), "alpine")
+	is.True(ok)
+	is.Equal("1.25.4-alpine", v.Tag)
+
+	v, ok = Latest(tags, nil, "")
+	is.True(ok)
+	is.Equal("1.26.0", v.Tag)
+
+	v, ok = Latest(tags, MustParseConstraint("^2"), "")
+	is.False(ok)
+	is.Nil(v)
+
+}